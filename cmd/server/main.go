@@ -19,6 +19,14 @@ func main() {
 	// Load .env for local/dev runs. It is safe if the file does not exist.
 	_ = godotenv.Load(".env")
 
+	// `favget migrate ...` manages the database schema and exits.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := app.RunMigrate(os.Args[2:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
 	// Build the full HTTP handler tree (DB, Redis, Cloudinary, router).
 	h, cleanup, err := app.NewHandler()
 	if err != nil {
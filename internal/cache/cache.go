@@ -0,0 +1,112 @@
+// Package cache holds short-lived lookups (resolved icon entries, negative
+// results). Backends implement Cache: an in-process LRU (Memory), Redis, and
+// a two-tier composition of the two (Tiered).
+package cache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrMiss is returned by Get when the key is absent or expired.
+var ErrMiss = errors.New("cache: miss")
+
+// Cache is a string key/value store with per-entry expiry.
+type Cache interface {
+	// Get returns the value stored under key, or ErrMiss.
+	Get(ctx context.Context, key string) (string, error)
+	// Set stores val under key with the cache's default TTL.
+	Set(ctx context.Context, key, val string) error
+	// SetWithTTL stores val with an explicit TTL. Useful for negative caching.
+	SetWithTTL(ctx context.Context, key, val string, ttl time.Duration) error
+	// Delete removes keys; absent keys are ignored.
+	Delete(ctx context.Context, keys ...string) error
+	// DeleteMatch removes every key matching pattern, in which "*" matches
+	// any run of characters and nothing else is special. It returns how
+	// many keys were removed.
+	DeleteMatch(ctx context.Context, pattern string) (int, error)
+	// Stats reports hit/miss counters since the cache was created.
+	Stats() Stats
+	// Close releases connections held by the cache.
+	Close() error
+}
+
+// Stats are cumulative Get counters. Entries is the number of keys held
+// locally, or -1 when the backend does not track it.
+type Stats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+// Options configures New.
+type Options struct {
+	RedisURL  string        // optional; empty = in-process cache only
+	TTL       time.Duration // default TTL for Set
+	LocalSize int           // max entries in the in-process cache; 0 disables it when Redis is set
+	LocalTTL  time.Duration // max lifetime of an in-process entry in front of Redis
+}
+
+// New builds the cache selected by opt:
+//   - no Redis: an in-process LRU of LocalSize entries (at least 1024);
+//   - Redis and LocalSize > 0: Tiered, with the LRU as L1 in front of Redis;
+//   - Redis only: Redis.
+//
+// An unusable REDIS_URL is logged and falls back to the in-process cache.
+func New(opt Options) Cache {
+	if opt.RedisURL != "" {
+		r, err := NewRedis(opt.RedisURL, opt.TTL)
+		if err == nil {
+			if opt.LocalSize <= 0 {
+				return r
+			}
+			return NewTiered(NewMemory(opt.LocalSize, opt.TTL), r, opt.LocalTTL)
+		}
+		log.Printf("Warning: Redis connection failed: %v; using in-process cache", err)
+	}
+	size := opt.LocalSize
+	if size < 1024 {
+		size = 1024
+	}
+	return NewMemory(size, opt.TTL)
+}
+
+// RedisClient returns the Redis client behind c, unwrapping Tiered, or nil
+// for in-process caches. Rate limiting needs Redis to be shared across
+// replicas and is disabled without it.
+func RedisClient(c Cache) *redis.Client {
+	switch v := c.(type) {
+	case *Redis:
+		return v.RDB
+	case *Tiered:
+		return RedisClient(v.L2)
+	}
+	return nil
+}
+
+// matchGlob reports whether key matches pattern, where "*" matches any run
+// of characters (including none).
+func matchGlob(pattern, key string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return key == pattern
+	}
+	if !strings.HasPrefix(key, parts[0]) {
+		return false
+	}
+	key = key[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, p := range parts[1 : len(parts)-1] {
+		i := strings.Index(key, p)
+		if i < 0 {
+			return false
+		}
+		key = key[i+len(p):]
+	}
+	return strings.HasSuffix(key, last)
+}
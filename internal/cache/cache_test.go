@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryLRU(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	c := NewMemory(2, 0)
+	_ = c.Set(ctx, "a", "1")
+	_ = c.Set(ctx, "b", "2")
+	if _, err := c.Get(ctx, "a"); err != nil { // a is now most recently used
+		t.Fatalf("Get(a): %v", err)
+	}
+	_ = c.Set(ctx, "c", "3") // evicts b
+
+	if _, err := c.Get(ctx, "b"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("Get(b) err = %v, want ErrMiss", err)
+	}
+	for _, k := range []string{"a", "c"} {
+		if _, err := c.Get(ctx, k); err != nil {
+			t.Fatalf("Get(%s): %v", k, err)
+		}
+	}
+	_ = c.Delete(ctx, "a", "missing")
+	if _, err := c.Get(ctx, "a"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("Get(a) after Delete err = %v, want ErrMiss", err)
+	}
+
+	if got, want := c.Stats(), (Stats{Hits: 3, Misses: 2, Entries: 1}); got != want {
+		t.Fatalf("Stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestMemoryExpiry(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	now := time.Unix(1000, 0)
+	c := NewMemory(10, time.Minute)
+	c.now = func() time.Time { return now }
+
+	_ = c.Set(ctx, "default", "v")
+	_ = c.SetWithTTL(ctx, "short", "v", time.Second)
+	_ = c.SetWithTTL(ctx, "forever", "v", 0)
+
+	now = now.Add(2 * time.Second)
+	if _, err := c.Get(ctx, "short"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("short: err = %v, want ErrMiss", err)
+	}
+	if _, err := c.Get(ctx, "default"); err != nil {
+		t.Fatalf("default: %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := c.Get(ctx, "default"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("default after TTL: err = %v, want ErrMiss", err)
+	}
+	if _, err := c.Get(ctx, "forever"); err != nil {
+		t.Fatalf("forever: %v", err)
+	}
+	if n := c.Stats().Entries; n != 1 {
+		t.Fatalf("Entries = %d, want expired entries dropped", n)
+	}
+}
+
+func TestTiered(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	l1, l2 := NewMemory(10, time.Hour), NewMemory(10, time.Hour)
+	c := NewTiered(l1, l2, time.Minute)
+
+	// A value only in L2 (written by another replica) is promoted to L1.
+	_ = l2.Set(ctx, "k", "v")
+	if v, err := c.Get(ctx, "k"); err != nil || v != "v" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+	if _, err := l1.Get(ctx, "k"); err != nil {
+		t.Fatalf("L1 not populated: %v", err)
+	}
+
+	_ = c.SetWithTTL(ctx, "neg", "x", time.Second)
+	for _, tier := range []*Memory{l1, l2} {
+		if _, err := tier.Get(ctx, "neg"); err != nil {
+			t.Fatalf("write not sent to both tiers: %v", err)
+		}
+	}
+
+	_ = c.Delete(ctx, "k")
+	if _, err := c.Get(ctx, "k"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("Get after Delete err = %v, want ErrMiss", err)
+	}
+
+	if s := c.Stats(); s.Hits != 1 || s.Misses != 1 {
+		t.Fatalf("Stats = %+v, want 1 hit, 1 miss", s)
+	}
+	if RedisClient(c) != nil {
+		t.Fatal("RedisClient of an in-process cache should be nil")
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pattern, key string
+		want         bool
+	}{
+		{"icon:example.com", "icon:example.com", true},
+		{"icon:example.com", "icon:example.com@64_png", false},
+		{"icon:example.com@*", "icon:example.com@64_png", true},
+		{"icon:*.example.com", "icon:www.example.com", true},
+		{"icon:*.example.com", "icon:example.com", false},
+		{"icon:*.example.com@*", "icon:a.b.example.com@32_ico", true},
+		{"icon:*", "icon-miss:example.com", false},
+		{"icon:shop-*-eu.com", "icon:shop-berlin-eu.com", true},
+		{"icon:shop-*-eu.com", "icon:shop-eu.com", false},
+		{"*", "", true},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.key); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestDeleteMatch(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	l1, l2 := NewMemory(10, time.Hour), NewMemory(10, time.Hour)
+	c := NewTiered(l1, l2, time.Minute)
+	for _, k := range []string{"icon:a.example.com", "icon:a.example.com@64_png", "icon-miss:b.example.com", "icon:example.org"} {
+		_ = c.Set(ctx, k, "v")
+	}
+
+	if n, err := c.DeleteMatch(ctx, "icon:*.example.com"); err != nil || n != 1 {
+		t.Fatalf("DeleteMatch = %d, %v; want 1", n, err)
+	}
+	for _, tier := range []*Memory{l1, l2} {
+		if _, err := tier.Get(ctx, "icon:a.example.com"); !errors.Is(err, ErrMiss) {
+			t.Fatalf("key left in a tier: err = %v", err)
+		}
+		if _, err := tier.Get(ctx, "icon:example.org"); err != nil {
+			t.Fatalf("unrelated key deleted: %v", err)
+		}
+	}
+	if n, _ := c.DeleteMatch(ctx, "*"); n != 3 {
+		t.Fatalf("DeleteMatch(*) = %d, want 3", n)
+	}
+}
@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Memory is an in-process LRU cache with per-entry expiry. It holds at most
+// maxEntries keys; adding one more evicts the least recently used.
+type Memory struct {
+	mu         sync.Mutex
+	ll         *list.List // front = most recently used
+	items      map[string]*list.Element
+	maxEntries int
+	ttl        time.Duration
+	now        func() time.Time
+
+	hits, misses atomic.Uint64
+}
+
+type memoryEntry struct {
+	key     string
+	val     string
+	expires time.Time // zero = never
+}
+
+// NewMemory returns an LRU cache of at most maxEntries keys (minimum 1).
+// Entries written with Set expire after ttl; ttl <= 0 means no expiry.
+func NewMemory(maxEntries int, ttl time.Duration) *Memory {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+	return &Memory{
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		now:        time.Now,
+	}
+}
+
+func (c *Memory) Get(_ context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		c.misses.Add(1)
+		return "", ErrMiss
+	}
+	e := el.Value.(*memoryEntry)
+	if !e.expires.IsZero() && !c.now().Before(e.expires) {
+		c.removeElement(el)
+		c.misses.Add(1)
+		return "", ErrMiss
+	}
+	c.ll.MoveToFront(el)
+	c.hits.Add(1)
+	return e.val, nil
+}
+
+func (c *Memory) Set(ctx context.Context, key, val string) error {
+	return c.SetWithTTL(ctx, key, val, c.ttl)
+}
+
+// SetWithTTL stores val with an explicit TTL; ttl <= 0 means no expiry.
+func (c *Memory) SetWithTTL(_ context.Context, key, val string, ttl time.Duration) error {
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.now().Add(ttl)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*memoryEntry)
+		e.val, e.expires = val, expires
+		c.ll.MoveToFront(el)
+		return nil
+	}
+	c.items[key] = c.ll.PushFront(&memoryEntry{key: key, val: val, expires: expires})
+	for c.ll.Len() > c.maxEntries {
+		c.removeElement(c.ll.Back())
+	}
+	return nil
+}
+
+func (c *Memory) Delete(_ context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range keys {
+		if el, ok := c.items[k]; ok {
+			c.removeElement(el)
+		}
+	}
+	return nil
+}
+
+func (c *Memory) DeleteMatch(_ context.Context, pattern string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for k, el := range c.items {
+		if matchGlob(pattern, k) {
+			c.removeElement(el)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (c *Memory) Stats() Stats {
+	c.mu.Lock()
+	n := c.ll.Len()
+	c.mu.Unlock()
+	return Stats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: n}
+}
+
+func (c *Memory) Close() error { return nil }
+
+func (c *Memory) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*memoryEntry).key)
+}
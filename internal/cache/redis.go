@@ -2,62 +2,97 @@ package cache
 
 import (
 	"context"
-	"log"
+	"errors"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
-type Cache struct {
+// Redis is a Cache backed by a Redis server, shared by all replicas.
+type Redis struct {
 	RDB *redis.Client
 	ttl time.Duration
+
+	hits, misses atomic.Uint64
 }
 
-func New(redisURL string, ttlSec int) *Cache {
-	if redisURL == "" {
-		return &Cache{ttl: time.Duration(ttlSec) * time.Second}
-	}
+// NewRedis connects to the Redis server at redisURL. Entries written with
+// Set expire after ttl.
+func NewRedis(redisURL string, ttl time.Duration) (*Redis, error) {
 	opt, err := redis.ParseURL(redisURL)
 	if err != nil {
-		log.Printf("Warning: Redis connection failed: %v", err)
-		return &Cache{ttl: time.Duration(ttlSec) * time.Second}
-	}
-	return &Cache{
-		RDB: redis.NewClient(opt),
-		ttl: time.Duration(ttlSec) * time.Second,
+		return nil, err
 	}
+	return &Redis{RDB: redis.NewClient(opt), ttl: ttl}, nil
 }
 
-func (c *Cache) GetRedisClient() *redis.Client {
-	return c.RDB
-}
-
-func (c *Cache) Get(ctx context.Context, key string) (string, error) {
-	if c.RDB == nil {
-		return "", redis.Nil
+func (c *Redis) Get(ctx context.Context, key string) (string, error) {
+	v, err := c.RDB.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		c.misses.Add(1)
+		return "", ErrMiss
 	}
-	return c.RDB.Get(ctx, key).Result()
+	if err != nil {
+		c.misses.Add(1)
+		return "", err
+	}
+	c.hits.Add(1)
+	return v, nil
 }
 
-func (c *Cache) Set(ctx context.Context, key, val string) error {
-	if c.RDB == nil {
-		return nil
-	}
+func (c *Redis) Set(ctx context.Context, key, val string) error {
 	return c.RDB.Set(ctx, key, val, c.ttl).Err()
 }
 
 // SetWithTTL stores val with an explicit TTL. Useful for negative caching.
-func (c *Cache) SetWithTTL(ctx context.Context, key, val string, ttl time.Duration) error {
-	if c.RDB == nil {
-		return nil
-	}
+func (c *Redis) SetWithTTL(ctx context.Context, key, val string, ttl time.Duration) error {
 	return c.RDB.Set(ctx, key, val, ttl).Err()
 }
 
-// Close closes the underlying Redis client if configured.
-func (c *Cache) Close() error {
-	if c.RDB == nil {
+func (c *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
 		return nil
 	}
+	return c.RDB.Del(ctx, keys...).Err()
+}
+
+// DeleteMatch walks the keyspace with SCAN and deletes matches in batches,
+// so it does not block Redis the way KEYS would.
+func (c *Redis) DeleteMatch(ctx context.Context, pattern string) (int, error) {
+	match := redisGlobEscaper.Replace(pattern)
+	n := 0
+	var cursor uint64
+	for {
+		keys, next, err := c.RDB.Scan(ctx, cursor, match, 1000).Result()
+		if err != nil {
+			return n, err
+		}
+		if len(keys) > 0 {
+			removed, err := c.RDB.Del(ctx, keys...).Result()
+			if err != nil {
+				return n, err
+			}
+			n += int(removed)
+		}
+		if next == 0 {
+			return n, nil
+		}
+		cursor = next
+	}
+}
+
+// redisGlobEscaper leaves "*" as the only special character in a MATCH
+// pattern.
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// Stats reports this process's Get counters; Entries is not tracked.
+func (c *Redis) Stats() Stats {
+	return Stats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: -1}
+}
+
+// Close closes the underlying Redis client.
+func (c *Redis) Close() error {
 	return c.RDB.Close()
 }
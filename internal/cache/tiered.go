@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// Tiered puts a fast local cache (L1) in front of a shared one (L2). Reads
+// try L1, then L2, copying L2 hits into L1. Writes and deletes go to both.
+//
+// L1 entries live at most L1TTL, which bounds how long one replica can serve
+// a value another replica has since overwritten or deleted in L2.
+type Tiered struct {
+	L1    Cache
+	L2    Cache
+	L1TTL time.Duration
+
+	hits, misses atomic.Uint64
+}
+
+// DefaultL1TTL is used when NewTiered is given l1TTL <= 0.
+const DefaultL1TTL = 30 * time.Second
+
+// NewTiered composes l1 in front of l2.
+func NewTiered(l1, l2 Cache, l1TTL time.Duration) *Tiered {
+	if l1TTL <= 0 {
+		l1TTL = DefaultL1TTL
+	}
+	return &Tiered{L1: l1, L2: l2, L1TTL: l1TTL}
+}
+
+func (c *Tiered) Get(ctx context.Context, key string) (string, error) {
+	if v, err := c.L1.Get(ctx, key); err == nil {
+		c.hits.Add(1)
+		return v, nil
+	}
+	v, err := c.L2.Get(ctx, key)
+	if err != nil {
+		c.misses.Add(1)
+		return "", err
+	}
+	_ = c.L1.SetWithTTL(ctx, key, v, c.L1TTL)
+	c.hits.Add(1)
+	return v, nil
+}
+
+func (c *Tiered) Set(ctx context.Context, key, val string) error {
+	_ = c.L1.SetWithTTL(ctx, key, val, c.L1TTL)
+	return c.L2.Set(ctx, key, val)
+}
+
+// SetWithTTL stores val in L2 for ttl and in L1 for at most L1TTL.
+func (c *Tiered) SetWithTTL(ctx context.Context, key, val string, ttl time.Duration) error {
+	l1 := c.L1TTL
+	if ttl > 0 && ttl < l1 {
+		l1 = ttl
+	}
+	_ = c.L1.SetWithTTL(ctx, key, val, l1)
+	return c.L2.SetWithTTL(ctx, key, val, ttl)
+}
+
+func (c *Tiered) Delete(ctx context.Context, keys ...string) error {
+	return errors.Join(c.L1.Delete(ctx, keys...), c.L2.Delete(ctx, keys...))
+}
+
+// DeleteMatch removes matching keys from both tiers and reports L2's count.
+func (c *Tiered) DeleteMatch(ctx context.Context, pattern string) (int, error) {
+	_, err1 := c.L1.DeleteMatch(ctx, pattern)
+	n, err2 := c.L2.DeleteMatch(ctx, pattern)
+	return n, errors.Join(err1, err2)
+}
+
+// Stats counts a Get as a hit if either tier had the key. Entries is L1's.
+// Per-tier counters are available from L1.Stats and L2.Stats.
+func (c *Tiered) Stats() Stats {
+	return Stats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: c.L1.Stats().Entries}
+}
+
+func (c *Tiered) Close() error {
+	return errors.Join(c.L1.Close(), c.L2.Close())
+}
@@ -1,40 +1,130 @@
 package cloud
 
 import (
+	"bytes"
 	"context"
-	"crypto/sha1"
-	"encoding/hex"
 	"fmt"
+	"io"
+	"net/http"
+	"time"
 
 	cloudinary "github.com/cloudinary/cloudinary-go/v2"
+	"github.com/cloudinary/cloudinary-go/v2/api"
+	"github.com/cloudinary/cloudinary-go/v2/api/admin"
 	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
+
+	"github.com/kudanilll/favget/internal/storage"
 )
 
+// Cloud is the Cloudinary storage backend. Keys are used as Cloudinary
+// public IDs; returned URLs are Cloudinary delivery URLs.
 type Cloud struct {
-	cld *cloudinary.Cloudinary
+	cld    *cloudinary.Cloudinary
+	client *http.Client
 }
 
+var _ storage.ObjectStore = (*Cloud)(nil)
+
 func New(cloudinaryURL string) (*Cloud, error) {
 	c, err := cloudinary.NewFromURL(cloudinaryURL)
 	if err != nil {
 		return nil, err
 	}
-	return &Cloud{cld: c}, nil
-}
-
-func publicID(domain, src string) string {
-	h := sha1.Sum([]byte(src))
-	return fmt.Sprintf("favget/%s/%s", domain, hex.EncodeToString(h[:]))
+	return &Cloud{cld: c, client: &http.Client{Timeout: 15 * time.Second}}, nil
 }
 
-func (c *Cloud) UploadRemote(ctx context.Context, domain, srcURL string) (string, error) {
+func (c *Cloud) Put(ctx context.Context, key string, data []byte, contentType string) (string, error) {
 	overwrite := true
-	resp, err := c.cld.Upload.Upload(ctx, srcURL, uploader.UploadParams{
-		PublicID:  publicID(domain, srcURL),
+	resp, err := c.cld.Upload.Upload(ctx, bytes.NewReader(data), uploader.UploadParams{
+		PublicID:  key,
 		Overwrite: &overwrite,
 	})
 	if err != nil {
 		return "", err
 	}
+	if resp.Error.Message != "" {
+		return "", fmt.Errorf("cloudinary: %s", resp.Error.Message)
+	}
 	return resp.SecureURL, nil
 }
+
+// Get downloads the original asset from its delivery URL.
+func (c *Cloud) Get(ctx context.Context, key string) (io.ReadCloser, storage.ObjectInfo, error) {
+	asset, err := c.cld.Image(key)
+	if err != nil {
+		return nil, storage.ObjectInfo{}, err
+	}
+	asset.Config.URL.Secure = true
+	u, err := asset.String()
+	if err != nil {
+		return nil, storage.ObjectInfo{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, storage.ObjectInfo{}, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, storage.ObjectInfo{}, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, storage.ObjectInfo{}, storage.ErrNotFound
+	default:
+		resp.Body.Close()
+		return nil, storage.ObjectInfo{}, fmt.Errorf("cloudinary: GET %s", resp.Status)
+	}
+
+	info := storage.ObjectInfo{
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        resp.ContentLength,
+		ETag:        resp.Header.Get("ETag"),
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.LastModified = t
+	}
+	return resp.Body, info, nil
+}
+
+func (c *Cloud) Delete(ctx context.Context, key string) error {
+	resp, err := c.cld.Upload.Destroy(ctx, uploader.DestroyParams{PublicID: key})
+	if err != nil {
+		return err
+	}
+	switch resp.Result {
+	case "ok":
+		return nil
+	case "not found":
+		return storage.ErrNotFound
+	}
+	return fmt.Errorf("cloudinary: destroy %s: %s", key, resp.Result)
+}
+
+// DeletePrefix deletes assets by public ID prefix through the Admin API,
+// which removes up to 1000 per call and reports a partial result when more
+// remain.
+func (c *Cloud) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	n := 0
+	params := admin.DeleteAssetsByPrefixParams{Prefix: api.CldAPIArray{prefix}}
+	for {
+		resp, err := c.cld.Admin.DeleteAssetsByPrefix(ctx, params)
+		if err != nil {
+			return n, err
+		}
+		if resp.Error.Message != "" {
+			return n, fmt.Errorf("cloudinary: delete %s*: %s", prefix, resp.Error.Message)
+		}
+		for _, result := range resp.Deleted {
+			if result == "deleted" {
+				n++
+			}
+		}
+		if !resp.Partial || resp.NextCursor == "" {
+			return n, nil
+		}
+		params.NextCursor = resp.NextCursor
+	}
+}
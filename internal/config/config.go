@@ -3,23 +3,49 @@ package config
 import (
 	"log"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 )
 
 type Config struct {
-	Port                string
-	DatabaseURL         string
-	RedisURL            string // optional; empty = caching disabled
-	CloudinaryURL       string
-	Env                 string
-	RateLimitRPS        int
-	CacheTTLSec         int
-	NegativeCacheTTLSec int
-	APIKeys             []string // one or more API keys (comma-separated in env)
-	AllowedOrigins      string   // comma-separated list of allowed CORS origins
-	AllowInsecureTLS    bool     // default false; allow InsecureSkipVerify for broken sites
-	MaxHTMLBytes        int64    // max bytes to read when fetching a page's HTML for icon parsing
+	Port                    string
+	DatabaseURL             string
+	AutoMigrate             bool   // apply pending schema migrations on startup (default true)
+	RedisURL                string // optional; empty = in-process cache only
+	CloudinaryURL           string // required when StorageBackend is "cloudinary"
+	StorageBackend          string // "cloudinary" (default), "local" or "s3"
+	StoragePublicURL        string // URL prefix for local/S3 object URLs
+	LocalStorageDir         string // root directory for the local backend
+	S3Endpoint              string
+	S3Bucket                string
+	S3Region                string
+	S3AccessKeyID           string
+	S3SecretAccessKey       string
+	IconDeliveryMode        string // default /v1/icon delivery: "redirect" or "proxy"
+	Env                     string
+	RateLimitRPS            int
+	CacheTTLSec             int
+	CacheLocalSize          int      // max entries in the in-process cache (L1 in front of Redis)
+	CacheLocalTTLSec        int      // max lifetime of an in-process entry when Redis is set
+	NegativeCacheTTLSec     int      // TTL for "site has no icon" results
+	NegativeTransientTTLSec int      // TTL for timeouts and other transient upstream failures
+	APIKeys                 []string // one or more API keys (comma-separated in env)
+	AdminAPIKeys            []string // keys for the admin purge API; none disables it
+	AllowedOrigins          string   // comma-separated list of allowed CORS origins
+	AllowInsecureTLS        bool     // default false; allow InsecureSkipVerify for broken sites
+	MaxHTMLBytes            int64    // max bytes to read when fetching a page's HTML for icon parsing
+	MaxIconBytes            int64    // max bytes to download for a single icon
+	MaxRedirects            int      // redirect hops followed per outbound fetch
+	SchemePolicy            string   // "https-only" (default), "https-then-http" or "http-allowed"
+	RefreshIntervalSec      int      // pause between background refresh scans; 0 disables the worker
+	RefreshMaxAgeSec        int      // revalidate icons not checked for this long
+	RefreshBatchSize        int      // icons revalidated per scan
+	IconSoftTTLSec          int      // serve older icons while re-resolving in the background; 0 disables
+	IconHardTTLSec          int      // re-resolve before serving icons older than this; 0 = never
+	BatchMaxDomains         int      // max domains per /v1/icons:batch request
+	BatchConcurrency        int      // concurrent lookups per batch request
+	SVGMode                 string   // "sanitize" (default) or "rasterize"
 }
 
 func mustGet(k string) string {
@@ -108,20 +134,106 @@ func Load() Config {
 			ttl = n
 		}
 	}
-	negTTL := 300 // 5 minutes default for negative cache
+	negTTL := 300 // 5 minutes default for "site has no icon"
 	if v := os.Getenv("NEGATIVE_CACHE_TTL_SECONDS"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil {
 			negTTL = n
 		}
 	}
+	negTransient := 30 // timeouts and 5xx are retried soon
+	if v := os.Getenv("NEGATIVE_CACHE_TRANSIENT_TTL_SECONDS"); v != "" {
+		// 0 would read as "use the default" downstream, not "disabled".
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Fatalf("NEGATIVE_CACHE_TRANSIENT_TTL_SECONDS must be a whole number of seconds, at least 1; got %q", v)
+		}
+		negTransient = n
+	}
+	localSize := 10000
+	if v := os.Getenv("CACHE_LOCAL_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			localSize = n
+		}
+	}
+	localTTL := 30
+	if v := os.Getenv("CACHE_LOCAL_TTL_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			localTTL = n
+		}
+	}
 	maxHTML := int64(1 << 20) // 1 MiB default
 	if v := os.Getenv("MAX_HTML_BYTES"); v != "" {
 		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
 			maxHTML = n
 		}
 	}
+	maxIcon := int64(1 << 20) // 1 MiB default
+	if v := os.Getenv("MAX_ICON_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			maxIcon = n
+		}
+	}
+
+	maxRedirects := 5
+	if v := os.Getenv("MAX_REDIRECTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			maxRedirects = n
+		}
+	}
+	refreshInterval := 3600 // 1 hour between scans
+	if v := os.Getenv("REFRESH_INTERVAL_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			refreshInterval = n
+		}
+	}
+	refreshMaxAge := 7 * 86400 // revalidate weekly
+	if v := os.Getenv("REFRESH_MAX_AGE_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			refreshMaxAge = n
+		}
+	}
+	softTTL := 86400 // serve stale for a day before revalidating in the background
+	if v := os.Getenv("ICON_SOFT_TTL_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			softTTL = n
+		}
+	}
+	hardTTL := 0 // never block on a revalidation by default
+	if v := os.Getenv("ICON_HARD_TTL_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			hardTTL = n
+		}
+	}
+	if hardTTL > 0 && softTTL > hardTTL {
+		log.Fatalf("ICON_SOFT_TTL_SECONDS (%d) must not exceed ICON_HARD_TTL_SECONDS (%d)", softTTL, hardTTL)
+	}
+	refreshBatch := 50
+	if v := os.Getenv("REFRESH_BATCH_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			refreshBatch = n
+		}
+	}
+
+	batchMax := 500
+	if v := os.Getenv("BATCH_MAX_DOMAINS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			batchMax = n
+		}
+	}
+	batchConc := 8
+	if v := os.Getenv("BATCH_CONCURRENCY"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			batchConc = n
+		}
+	}
 
 	apiKeys := parseAPIKeys(os.Getenv("API_KEY"))
+	adminKeys := parseAPIKeys(os.Getenv("ADMIN_API_KEY"))
+	for _, k := range adminKeys {
+		if slices.Contains(apiKeys, k) {
+			log.Fatal("ADMIN_API_KEY must not reuse a key from API_KEY")
+		}
+	}
 	env := normalizeEnv(getDefault("APP_ENV", "production"))
 	allowedOrigins := parseAllowedOrigins(getDefault("CORS_ALLOWED_ORIGINS", ""))
 
@@ -133,23 +245,90 @@ func Load() Config {
 		}
 	}
 
+	autoMigrate := true
+	if v := os.Getenv("DB_AUTO_MIGRATE"); v != "" {
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "false", "0", "no":
+			autoMigrate = false
+		}
+	}
+
+	backend := strings.ToLower(strings.TrimSpace(getDefault("STORAGE_BACKEND", "cloudinary")))
+	cloudinaryURL := os.Getenv("CLOUDINARY_URL")
+	switch backend {
+	case "cloudinary":
+		cloudinaryURL = mustGet("CLOUDINARY_URL")
+	case "local":
+	case "s3":
+		mustGet("S3_ENDPOINT")
+		mustGet("S3_BUCKET")
+		mustGet("S3_ACCESS_KEY_ID")
+		mustGet("S3_SECRET_ACCESS_KEY")
+	default:
+		log.Fatalf("unknown STORAGE_BACKEND %q; use cloudinary, local or s3", backend)
+	}
+
+	mode := strings.ToLower(strings.TrimSpace(getDefault("ICON_DELIVERY_MODE", "redirect")))
+	if mode != "redirect" && mode != "proxy" {
+		log.Fatalf("unknown ICON_DELIVERY_MODE %q; use redirect or proxy", mode)
+	}
+
+	schemePolicy := strings.ToLower(strings.TrimSpace(getDefault("SCHEME_POLICY", "https-only")))
+	switch schemePolicy {
+	case "https-only", "https-then-http", "http-allowed":
+	default:
+		log.Fatalf("unknown SCHEME_POLICY %q; use https-only, https-then-http or http-allowed", schemePolicy)
+	}
+
+	svgMode := strings.ToLower(strings.TrimSpace(getDefault("SVG_MODE", "sanitize")))
+	switch svgMode {
+	case "sanitize", "rasterize":
+	default:
+		log.Fatalf("unknown SVG_MODE %q; use sanitize or rasterize", svgMode)
+	}
+
 	// Production safety: require API_KEY when APP_ENV=production.
 	if env == "production" && len(apiKeys) == 0 {
 		log.Fatal("API_KEY is required when APP_ENV=production; set a strong random key")
 	}
 
 	return Config{
-		Port:                getDefault("PORT", "8080"),
-		DatabaseURL:         mustGet("DATABASE_URL"),
-		RedisURL:            getDefault("REDIS_URL", ""), // optional – omit to disable caching
-		CloudinaryURL:       mustGet("CLOUDINARY_URL"),
-		Env:                 env,
-		RateLimitRPS:        rl,
-		CacheTTLSec:         ttl,
-		NegativeCacheTTLSec: negTTL,
-		APIKeys:             apiKeys,
-		AllowedOrigins:      strings.Join(allowedOrigins, ","),
-		AllowInsecureTLS:    allowInsecure,
-		MaxHTMLBytes:        maxHTML,
+		Port:                    getDefault("PORT", "8080"),
+		DatabaseURL:             mustGet("DATABASE_URL"),
+		AutoMigrate:             autoMigrate,
+		RedisURL:                getDefault("REDIS_URL", ""), // optional – omit to cache in-process only
+		CloudinaryURL:           cloudinaryURL,
+		StorageBackend:          backend,
+		StoragePublicURL:        getDefault("STORAGE_PUBLIC_URL", ""),
+		LocalStorageDir:         getDefault("LOCAL_STORAGE_DIR", "./data/icons"),
+		S3Endpoint:              getDefault("S3_ENDPOINT", ""),
+		S3Bucket:                getDefault("S3_BUCKET", ""),
+		S3Region:                getDefault("S3_REGION", "us-east-1"),
+		S3AccessKeyID:           getDefault("S3_ACCESS_KEY_ID", ""),
+		S3SecretAccessKey:       getDefault("S3_SECRET_ACCESS_KEY", ""),
+		IconDeliveryMode:        mode,
+		Env:                     env,
+		RateLimitRPS:            rl,
+		CacheTTLSec:             ttl,
+		CacheLocalSize:          localSize,
+		CacheLocalTTLSec:        localTTL,
+		NegativeCacheTTLSec:     negTTL,
+		NegativeTransientTTLSec: negTransient,
+		APIKeys:                 apiKeys,
+		AdminAPIKeys:            adminKeys,
+		AllowedOrigins:          strings.Join(allowedOrigins, ","),
+		AllowInsecureTLS:        allowInsecure,
+		MaxHTMLBytes:            maxHTML,
+		MaxIconBytes:            maxIcon,
+		MaxRedirects:            maxRedirects,
+		SchemePolicy:            schemePolicy,
+		RefreshIntervalSec:      refreshInterval,
+		RefreshMaxAgeSec:        refreshMaxAge,
+		RefreshBatchSize:        refreshBatch,
+		IconSoftTTLSec:          softTTL,
+		IconHardTTLSec:          hardTTL,
+		BatchMaxDomains:         batchMax,
+		BatchConcurrency:        batchConc,
+		SVGMode:                 svgMode,
 	}
 }
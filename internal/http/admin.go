@@ -0,0 +1,316 @@
+package httpx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/kudanilll/favget/internal/cache"
+	"github.com/kudanilll/favget/internal/resolver"
+	"github.com/kudanilll/favget/internal/storage"
+	"github.com/kudanilll/favget/internal/store"
+)
+
+// maxPurgeBodyBytes caps /v1/admin/purge request bodies.
+const maxPurgeBodyBytes = 64 << 10
+
+type purgeRequest struct {
+	Domain  string `json:"domain"`  // one domain
+	Pattern string `json:"pattern"` // or domains matching a "*" wildcard, e.g. "*.example.com"
+	All     bool   `json:"all"`     // or everything
+	Resolve bool   `json:"resolve"` // re-resolve the purged domains right away
+	History bool   `json:"history"` // also delete the domains' icon history
+}
+
+type purgeResponse struct {
+	Domain    string       `json:"domain,omitempty"`
+	Pattern   string       `json:"pattern,omitempty"`
+	Purged    int          `json:"purged"`              // icons rows removed
+	Versions  int          `json:"versions_deleted"`    // icon_versions rows removed (with "history")
+	Objects   int          `json:"objects_deleted"`     // legacy per-domain objects removed (icons and renditions)
+	Blobs     int          `json:"blobs_deleted"`       // content-addressed blobs no longer used by any icon
+	CacheKeys int          `json:"cache_keys_deleted"`  // positive, rendition and negative cache entries removed
+	Resolving int          `json:"resolving,omitempty"` // domains being re-resolved in the background
+	Result    *batchResult `json:"result,omitempty"`    // re-resolve outcome for a single domain
+	Errors    []string     `json:"errors,omitempty"`    // cache or storage cleanups that failed
+}
+
+// handlePurge evicts one domain, every domain matching a pattern, or
+// everything: the icons rows, the cache entries and the stored objects, and
+// with "history" the icon history too. With "resolve", a single domain is
+// re-resolved before responding; purged patterns are re-resolved in the
+// background.
+func (s *Server) handlePurge(w http.ResponseWriter, r *http.Request) {
+	s.setSecurityHeaders(w)
+
+	var req purgeRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPurgeBodyBytes)).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	s.purgeAndRespond(w, r, req)
+}
+
+// handlePurgeDomain is DELETE /v1/admin/icons/{domain}[?resolve=true][&history=true].
+func (s *Server) handlePurgeDomain(w http.ResponseWriter, r *http.Request) {
+	s.setSecurityHeaders(w)
+
+	resolve, _ := strconv.ParseBool(r.URL.Query().Get("resolve"))
+	history, _ := strconv.ParseBool(r.URL.Query().Get("history"))
+	s.purgeAndRespond(w, r, purgeRequest{Domain: chi.URLParam(r, "domain"), Resolve: resolve, History: history})
+}
+
+func (s *Server) purgeAndRespond(w http.ResponseWriter, r *http.Request, req purgeRequest) {
+	pattern, err := purgePattern(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, domains, err := s.purge(r.Context(), pattern, req.History)
+	if err != nil {
+		log.Printf("purge %q failed: %v", pattern, err)
+		http.Error(w, "purge failed", http.StatusInternalServerError)
+		return
+	}
+	if req.Domain != "" {
+		res.Domain = pattern
+	} else {
+		res.Pattern = pattern
+	}
+	log.Printf("purge %q: %d rows, %d versions, %d objects, %d cache keys", pattern, res.Purged, res.Versions, res.Objects, res.CacheKeys)
+
+	if req.Resolve {
+		if req.Domain != "" {
+			extendWriteDeadline(w, batchTimeout)
+			ctx, cancel := context.WithTimeout(r.Context(), batchTimeout)
+			defer cancel()
+			res.Result = &batchResult{Input: req.Domain, Domain: pattern}
+			s.batchLookup(ctx, res.Result)
+		} else if len(domains) > 0 {
+			res.Resolving = len(domains)
+			go s.resolveDomains(domains)
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+type statsResponse struct {
+	Cache cache.Stats `json:"cache"`
+}
+
+// handleStats reports this instance's cache counters since it started.
+// Replicas count separately; a tiered cache counts hits in either tier.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	s.setSecurityHeaders(w)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(statsResponse{Cache: s.Cache.Stats()})
+}
+
+// purgePattern validates req and returns what to purge: a normalized domain,
+// or a lowercase pattern in which "*" is the only wildcard ("*" for all).
+func purgePattern(req purgeRequest) (string, error) {
+	n := 0
+	for _, set := range []bool{req.Domain != "", req.Pattern != "", req.All} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return "", errors.New(`exactly one of "domain", "pattern" or "all" is required`)
+	}
+
+	switch {
+	case req.All:
+		return "*", nil
+	case req.Domain != "":
+		d, err := resolver.NormalizeDomain(req.Domain)
+		if err != nil {
+			return "", errors.New("invalid domain")
+		}
+		return d, nil
+	}
+
+	p := strings.ToLower(strings.TrimSpace(req.Pattern))
+	if len(p) > 253 {
+		return "", errors.New("invalid pattern: too long")
+	}
+	literal := false
+	for _, c := range p {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_':
+			literal = true
+		case c == '.', c == '*':
+		default:
+			return "", errors.New(`invalid pattern: use letters, digits, ".", "-", "_" and "*"`)
+		}
+	}
+	if !literal {
+		return "", errors.New(`pattern matches every domain; use "all": true`)
+	}
+	return p, nil
+}
+
+// purge removes the current icon of domains matching pattern (a single
+// domain when it has no "*") and, with history, their icon history, and
+// returns the counts and the domains whose rows were deleted. The rows go
+// first, so a concurrent lookup cannot re-warm the cache from them;
+// failures after that are reported in Errors rather than aborting the purge.
+func (s *Server) purge(ctx context.Context, pattern string, history bool) (purgeResponse, []string, error) {
+	var res purgeResponse
+	single := !strings.Contains(pattern, "*")
+
+	var recs []store.IconRecord
+	if single {
+		rec, err := s.DB.Delete(ctx, pattern)
+		switch {
+		case err == nil:
+			recs = append(recs, *rec)
+		case !errors.Is(err, pgx.ErrNoRows):
+			return res, nil, fmt.Errorf("delete row: %w", err)
+		}
+	} else {
+		var err error
+		if recs, err = s.DB.DeleteMatching(ctx, pattern); err != nil {
+			return res, nil, fmt.Errorf("delete rows: %w", err)
+		}
+	}
+	res.Purged = len(recs)
+	domains := make([]string, len(recs))
+	for i, rec := range recs {
+		domains[i] = rec.Domain
+	}
+
+	var versions []store.IconVersion
+	if history {
+		var err error
+		if versions, err = s.DB.DeleteVersions(ctx, pattern); err != nil {
+			return res, nil, fmt.Errorf("delete history: %w", err)
+		}
+		res.Versions = len(versions)
+	}
+
+	// Positive entries, their renditions (icon:<domain>@<size>_<format>)
+	// and negative entries.
+	for _, p := range []string{"icon:" + pattern, "icon:" + pattern + "@*", negativeKey(pattern)} {
+		n, err := s.Cache.DeleteMatch(ctx, p)
+		res.CacheKeys += n
+		if err != nil {
+			res.Errors = append(res.Errors, fmt.Sprintf("cache %s: %v", p, err))
+		}
+	}
+
+	// Legacy stored objects. Without history, only the purged icons and
+	// their renditions: older history versions may still use objects under
+	// the domain's key prefix. With history, everything under that prefix;
+	// a single domain is then cleaned up even without a row, to catch
+	// objects left behind by an earlier failure.
+	var prefixes []string
+	switch {
+	case !history:
+		for _, rec := range recs {
+			if rec.ContentHash == nil {
+				key := storage.ObjectKey(rec.Domain, rec.SourceURL)
+				if err := s.Store.Delete(ctx, key); err == nil {
+					res.Objects++
+				} else if !errors.Is(err, storage.ErrNotFound) {
+					res.Errors = append(res.Errors, fmt.Sprintf("storage %s: %v", key, err))
+				}
+				prefixes = append(prefixes, key+"_")
+			}
+		}
+	case pattern == "*":
+		prefixes = []string{storage.KeyPrefix}
+	case single:
+		prefixes = []string{storage.DomainPrefix(pattern)}
+	default:
+		seen := map[string]bool{}
+		for _, d := range domains {
+			seen[d] = true
+		}
+		for _, v := range versions {
+			seen[v.Domain] = true
+		}
+		for d := range seen {
+			prefixes = append(prefixes, storage.DomainPrefix(d))
+		}
+	}
+	for _, p := range prefixes {
+		n, err := s.Store.DeletePrefix(ctx, p)
+		res.Objects += n
+		if err != nil {
+			res.Errors = append(res.Errors, fmt.Sprintf("storage %s: %v", p, err))
+		}
+	}
+
+	// Blobs the purged icons and history versions no longer share with any
+	// other row. Purging everything already removed every object, so only
+	// the rows are dropped, including ones claimed moments ago that would
+	// otherwise point at deleted objects.
+	var n int
+	var err error
+	if pattern == "*" && history {
+		n, err = s.sweepBlobs(ctx, nil, 0, func(string, []string) error { return nil })
+	} else {
+		var hashes []string
+		for _, rec := range recs {
+			if rec.ContentHash != nil {
+				hashes = append(hashes, *rec.ContentHash)
+			}
+		}
+		for _, v := range versions {
+			hashes = append(hashes, v.ContentHash)
+		}
+		if len(hashes) > 0 {
+			n, err = s.sweepBlobs(ctx, hashes, purgeBlobGrace, nil)
+		}
+	}
+	res.Blobs = n
+	if err != nil {
+		res.Errors = append(res.Errors, fmt.Sprintf("blobs: %v", err))
+	}
+	return res, domains, nil
+}
+
+// resolveDomains re-resolves purged domains in the background, with at most
+// BatchConcurrency lookups in flight.
+func (s *Server) resolveDomains(domains []string) {
+	workers := s.BatchConcurrency
+	if workers <= 0 {
+		workers = defaultBatchConcurrency
+	}
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for range min(workers, len(domains)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range jobs {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				if _, err := s.lookupIcon(ctx, d, false); err != nil {
+					log.Printf("purge: re-resolve %s: %v", d, err)
+				}
+				cancel()
+			}
+		}()
+	}
+	for _, d := range domains {
+		jobs <- d
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -0,0 +1,166 @@
+package httpx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kudanilll/favget/internal/cache"
+	"github.com/kudanilll/favget/internal/storage"
+	"github.com/kudanilll/favget/internal/store"
+)
+
+func TestPurgePattern(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		req     purgeRequest
+		want    string
+		wantErr bool
+	}{
+		{"domain", purgeRequest{Domain: "WWW.Example.com"}, "example.com", false},
+		{"pattern", purgeRequest{Pattern: "*.Example.com"}, "*.example.com", false},
+		{"all", purgeRequest{All: true}, "*", false},
+		{"none", purgeRequest{}, "", true},
+		{"two", purgeRequest{Domain: "example.com", All: true}, "", true},
+		{"bad-domain", purgeRequest{Domain: "example.com/path"}, "", true},
+		{"bad-pattern", purgeRequest{Pattern: "exa%mple.com"}, "", true},
+		{"wildcard-only", purgeRequest{Pattern: "*.*"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := purgePattern(tt.req)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Fatalf("purgePattern = %q, %v; want %q (error: %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestAdminAuth checks that the admin routes take only the admin keys and
+// are not mounted without them. Requests are rejected before the DB is used.
+func TestAdminAuth(t *testing.T) {
+	t.Parallel()
+
+	admin := (&Server{Cache: cache.New(cache.Options{}), APIKeys: []string{"user"}, AdminAPIKeys: []string{"admin"}}).Routes()
+	noAdmin := (&Server{Cache: cache.New(cache.Options{}), APIKeys: []string{"user"}}).Routes()
+
+	tests := []struct {
+		name       string
+		h          http.Handler
+		key        string
+		body       string
+		wantStatus int
+	}{
+		{"user-key", admin, "user", `{"all":true}`, http.StatusUnauthorized},
+		{"no-key", admin, "", `{"all":true}`, http.StatusUnauthorized},
+		{"invalid-request", admin, "admin", `{"pattern":"*"}`, http.StatusBadRequest},
+		{"not-mounted", noAdmin, "user", `{"all":true}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest(http.MethodPost, "/v1/admin/purge", strings.NewReader(tt.body))
+			if tt.key != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.key)
+			}
+			w := httptest.NewRecorder()
+			tt.h.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminStats(t *testing.T) {
+	t.Parallel()
+
+	c := cache.New(cache.Options{})
+	h := (&Server{Cache: c, AdminAPIKeys: []string{"admin"}}).Routes()
+	ctx := context.Background()
+	_ = c.Set(ctx, "icon:example.com", "x")
+	_, _ = c.Get(ctx, "icon:example.com")
+	_, _ = c.Get(ctx, "icon:missing.example")
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/admin/stats", nil)
+	r.Header.Set("Authorization", "Bearer admin")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var resp statsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if want := (cache.Stats{Hits: 1, Misses: 1, Entries: 1}); resp.Cache != want {
+		t.Fatalf("stats = %+v, want %+v", resp.Cache, want)
+	}
+}
+
+// TestPurgeHistoryBlobs checks that purging a domain with its history
+// deletes the blobs only its history used, not just its current icon's. It
+// needs Postgres and is skipped unless FAVGET_TEST_DATABASE_URL is set (see
+// TestMigratePostgres; run with -p 1 when both use the same database).
+func TestPurgeHistoryBlobs(t *testing.T) {
+	url := os.Getenv("FAVGET_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("FAVGET_TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	db, err := store.New(ctx, url)
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	t.Cleanup(db.Close)
+	if _, err := db.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	objects, err := storage.NewLocal(t.TempDir(), "/objects")
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	s := &Server{DB: db, Store: objects, Cache: cache.New(cache.Options{})}
+
+	const domain = "purge-history.example"
+	var hashes []string
+	for _, content := range []string{"old icon " + domain, "new icon " + domain} {
+		hash := contentHash([]byte(content))
+		key, u, err := s.storeBlob(ctx, hash, []byte(content), "image/png")
+		if err != nil {
+			t.Fatalf("storeBlob: %v", err)
+		}
+		if _, err := db.Upsert(ctx, store.IconRecord{Domain: domain, IconURL: u, ContentHash: &hash}); err != nil {
+			t.Fatalf("Upsert: %v", err)
+		}
+		if _, err := db.AddVersion(ctx, store.IconVersion{Domain: domain, StorageURL: u, StorageKey: key, ContentHash: hash}); err != nil {
+			t.Fatalf("AddVersion: %v", err)
+		}
+		hashes = append(hashes, hash)
+	}
+	// Past the purge grace period, as if stored a while ago.
+	if _, err := db.Pool.Exec(ctx, `UPDATE blobs SET touched_at = NOW() - INTERVAL '1 hour' WHERE hash = ANY($1)`, hashes); err != nil {
+		t.Fatalf("age blobs: %v", err)
+	}
+
+	res, _, err := s.purge(ctx, domain, true)
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if res.Purged != 1 || res.Versions != 2 || res.Blobs != 2 || len(res.Errors) != 0 {
+		t.Fatalf("purge = %+v; want 1 row, 2 versions, 2 blobs", res)
+	}
+	for _, h := range hashes {
+		if _, _, err := objects.Get(ctx, storage.BlobKey(h)); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("blob %s still stored (err %v)", h, err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package httpx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kudanilll/favget/internal/resolver"
+)
+
+// Batch defaults, used when the Server fields are zero.
+const (
+	defaultBatchMaxDomains  = 500
+	defaultBatchConcurrency = 8
+	maxBatchBodyBytes       = 1 << 20
+	batchTimeout            = 30 * time.Second
+)
+
+// writeSlack is the time left after a handler's own deadline to write its
+// response.
+const writeSlack = 5 * time.Second
+
+// extendWriteDeadline lets a handler that works for up to d respond even
+// when d exceeds the server's WriteTimeout.
+func extendWriteDeadline(w http.ResponseWriter, d time.Duration) {
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(d + writeSlack))
+}
+
+// Per-domain outcomes reported by /v1/icons:batch.
+const (
+	batchStatusOK       = "ok"
+	batchStatusInvalid  = "invalid_domain"
+	batchStatusNotFound = "not_found"
+	batchStatusTimeout  = "timeout"
+)
+
+type batchRequest struct {
+	Domains []string `json:"domains"`
+}
+
+type batchResult struct {
+	Input       string     `json:"input"`
+	Domain      string     `json:"domain,omitempty"`
+	Status      string     `json:"status"`
+	URL         string     `json:"url,omitempty"`
+	ContentType string     `json:"content_type,omitempty"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+	Reason      string     `json:"reason,omitempty"` // failure reason, as in /v1/icon problem details
+	Error       string     `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+}
+
+// handleBatch resolves many domains in one request. Each domain goes through
+// the same cache → DB → resolve chain as /v1/icon (including its singleflight
+// group), with at most BatchConcurrency lookups in flight. Results keep the
+// request order; duplicates are looked up once.
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	s.setSecurityHeaders(w)
+
+	var req batchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBodyBytes)).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	maxDomains := s.BatchMaxDomains
+	if maxDomains <= 0 {
+		maxDomains = defaultBatchMaxDomains
+	}
+	if len(req.Domains) == 0 {
+		http.Error(w, "domains must not be empty", http.StatusBadRequest)
+		return
+	}
+	if len(req.Domains) > maxDomains {
+		http.Error(w, "too many domains (max "+strconv.Itoa(maxDomains)+")", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Lookups stop waiting at the deadline (see resolveAndUpload), so the
+	// response is written by then even if resolves are still running.
+	extendWriteDeadline(w, batchTimeout)
+	ctx, cancel := context.WithTimeout(r.Context(), batchTimeout)
+	defer cancel()
+
+	results := make([]batchResult, len(req.Domains))
+	first := map[string]int{} // normalized domain → index of its first occurrence
+	var todo []int
+	for i, in := range req.Domains {
+		results[i].Input = in
+		d, err := resolver.NormalizeDomain(in)
+		if err != nil {
+			results[i].Status, results[i].Error = batchStatusInvalid, "invalid domain"
+			continue
+		}
+		results[i].Domain = d
+		if _, dup := first[d]; !dup {
+			first[d] = i
+			todo = append(todo, i)
+		}
+	}
+
+	workers := s.BatchConcurrency
+	if workers <= 0 {
+		workers = defaultBatchConcurrency
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, len(todo)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				s.batchLookup(ctx, &results[i])
+			}
+		}()
+	}
+	for _, i := range todo {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i := range results {
+		if j, ok := first[results[i].Domain]; ok && j != i {
+			dup := results[j]
+			dup.Input = results[i].Input
+			results[i] = dup
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(batchResponse{Results: results})
+}
+
+// batchLookup fills res for res.Domain.
+func (s *Server) batchLookup(ctx context.Context, res *batchResult) {
+	if ctx.Err() != nil {
+		res.Status, res.Error = batchStatusTimeout, "batch deadline exceeded"
+		return
+	}
+	e, err := s.lookupIcon(ctx, res.Domain, false)
+	switch {
+	case err == nil:
+		res.Status, res.URL, res.ContentType = batchStatusOK, e.URL, e.ContentType
+		if !e.UpdatedAt.IsZero() {
+			t := e.UpdatedAt
+			res.UpdatedAt = &t
+		}
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		res.Status, res.Error = batchStatusTimeout, "batch deadline exceeded"
+	default:
+		p := lookupProblem(res.Domain, err)
+		res.Status, res.Reason, res.Error = batchStatusNotFound, string(p.Reason), err.Error()
+	}
+}
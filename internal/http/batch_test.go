@@ -0,0 +1,114 @@
+package httpx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kudanilll/favget/internal/cache"
+)
+
+// TestHandleBatchValidation covers request validation and per-domain
+// rejection, which never reach the cache/DB chain.
+func TestHandleBatchValidation(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{Cache: cache.New(cache.Options{}), BatchMaxDomains: 3}
+	h := s.Routes()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"bad-json", `{"domains":`, http.StatusBadRequest},
+		{"empty", `{"domains":[]}`, http.StatusBadRequest},
+		{"too-many", `{"domains":["a.com","b.com","c.com","d.com"]}`, http.StatusRequestEntityTooLarge},
+		{"all-invalid", `{"domains":["a.com/path","","https://"]}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/icons:batch", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var resp batchResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if len(resp.Results) != 3 {
+				t.Fatalf("got %d results, want 3", len(resp.Results))
+			}
+			for _, res := range resp.Results {
+				if res.Status != batchStatusInvalid || res.URL != "" {
+					t.Fatalf("result %+v, want %s", res, batchStatusInvalid)
+				}
+			}
+		})
+	}
+}
+
+// TestResolveAndUploadStopsWaiting checks that a caller whose deadline
+// passes stops waiting on a resolve another request started.
+func TestResolveAndUploadStopsWaiting(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{}
+	release := make(chan struct{})
+	defer close(release)
+	s.singleflight.DoChan("icon:slow.example", func() (interface{}, error) {
+		<-release
+		return iconEntry{}, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := s.resolveAndUpload("slow.example", ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("returned after %v, want right after the deadline", d)
+	}
+}
+
+// TestExtendWriteDeadline checks that a handler can respond after the
+// server's WriteTimeout once it extended its deadline.
+func TestExtendWriteDeadline(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		extendWriteDeadline(w, time.Second)
+		time.Sleep(300 * time.Millisecond)
+		_, _ = io.WriteString(w, "ok")
+	}))
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	if body, err := io.ReadAll(resp.Body); err != nil || string(body) != "ok" {
+		t.Fatalf("body = %q, %v; want ok", body, err)
+	}
+}
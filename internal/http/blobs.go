@@ -0,0 +1,123 @@
+package httpx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/kudanilll/favget/internal/storage"
+	"github.com/kudanilll/favget/internal/store"
+)
+
+// Blob cleanup. Every blobSweepInterval, unreferenced blobs are deleted
+// once blobSweepGrace has passed since they were last claimed, which covers
+// the window between claiming a blob and writing the icon row that
+// references it; purges use the shorter purgeBlobGrace so their objects go
+// away right after.
+const (
+	blobSweepInterval = 15 * time.Minute
+	blobSweepGrace    = time.Hour
+	purgeBlobGrace    = time.Minute
+	blobSweepBatch    = 100
+)
+
+// contentHash is the blob identity of data: its hex SHA-256.
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// storeBlob stores data under its content hash and returns the key and URL.
+// Bytes already stored for any domain are not uploaded again.
+func (s *Server) storeBlob(ctx context.Context, hash string, data []byte, contentType string) (string, string, error) {
+	key := storage.BlobKey(hash)
+	var ct *string
+	if contentType != "" {
+		ct = &contentType
+	}
+	b, err := s.DB.ClaimBlob(ctx, store.Blob{Hash: hash, StorageKey: key, ContentType: ct, Size: int64(len(data))})
+	switch {
+	case err != nil:
+		// Without the row the icon cannot reference the blob, but the bytes
+		// can still be served; a later re-store will register them.
+		log.Printf("blob claim failed for %s: %v", hash, err)
+	case b.StorageURL != "" && b.StorageKey == key:
+		return key, b.StorageURL, nil
+	}
+
+	// New blob, a failed earlier upload, or a history object adopted from
+	// before blobs existed: (re)upload under the content-addressed key.
+	u, err := s.Store.Put(ctx, key, data, contentType)
+	if err != nil {
+		return "", "", err
+	}
+	if b != nil {
+		if err := s.DB.SetBlobLocation(ctx, hash, key, u); err != nil {
+			log.Printf("blob update failed for %s: %v", hash, err)
+		}
+	}
+	return key, u, nil
+}
+
+// RunBlobSweeper deletes unreferenced blobs every blobSweepInterval until
+// ctx is done. It runs regardless of the refresher: icons change and
+// disappear through resolves and purges too.
+func (s *Server) RunBlobSweeper(ctx context.Context) {
+	t := time.NewTicker(blobSweepInterval)
+	defer t.Stop()
+	for {
+		if n, err := s.sweepBlobs(ctx, nil, blobSweepGrace, nil); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("blob sweep failed: %v", err)
+			}
+		} else if n > 0 {
+			log.Printf("blob sweep: deleted %d unused blobs", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// sweepBlobs deletes unreferenced blobs not claimed within grace, with
+// their renditions, and returns how many it deleted. hashes limits the
+// sweep to those blobs (nil: all). del overrides how objects are removed
+// (nil: delete them from the ObjectStore).
+func (s *Server) sweepBlobs(ctx context.Context, hashes []string, grace time.Duration, del func(key string, renditions []string) error) (int, error) {
+	if del == nil {
+		del = func(key string, renditions []string) error { return s.deleteBlobObjects(ctx, key, renditions) }
+	}
+	total := 0
+	for {
+		n, err := s.DB.SweepOrphanBlobs(ctx, hashes, grace, blobSweepBatch, del)
+		total += n
+		if err != nil || n < blobSweepBatch {
+			return total, err
+		}
+	}
+}
+
+// deleteBlobObjects removes a blob's object and its recorded renditions.
+// Renditions of blobs created before they were recorded (nil) are found by
+// listing the <key>_ prefix they are stored under, which costs a listing
+// (or a rate-limited Cloudinary Admin API call) per blob.
+func (s *Server) deleteBlobObjects(ctx context.Context, key string, renditions []string) error {
+	if err := s.Store.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	if renditions == nil {
+		_, err := s.Store.DeletePrefix(ctx, key+"_")
+		return err
+	}
+	for _, r := range renditions {
+		if err := s.Store.Delete(ctx, r); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
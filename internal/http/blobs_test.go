@@ -0,0 +1,85 @@
+package httpx
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/kudanilll/favget/internal/storage"
+	"github.com/kudanilll/favget/internal/store"
+)
+
+func TestEntryFromRecordKey(t *testing.T) {
+	t.Parallel()
+
+	hash := contentHash([]byte("icon"))
+	if len(hash) != 64 {
+		t.Fatalf("contentHash = %q, want hex SHA-256", hash)
+	}
+	if hash != contentHash([]byte("icon")) || hash == contentHash([]byte("icon2")) {
+		t.Fatal("contentHash is not a function of the content")
+	}
+
+	tests := []struct {
+		name string
+		rec  store.IconRecord
+		want string
+	}{
+		{"blob", store.IconRecord{Domain: "a.example", SourceURL: "https://a.example/favicon.ico", ContentHash: &hash}, storage.BlobKey(hash)},
+		{"legacy", store.IconRecord{Domain: "a.example", SourceURL: "https://a.example/favicon.ico"}, storage.ObjectKey("a.example", "https://a.example/favicon.ico")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := entryFromRecord(&tt.rec).Key; got != tt.want {
+				t.Fatalf("Key = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDeleteBlobObjects checks that recorded renditions are deleted by key
+// and only blobs whose renditions were never recorded list their prefix.
+func TestDeleteBlobObjects(t *testing.T) {
+	t.Parallel()
+
+	key := storage.BlobKey(contentHash([]byte("icon")))
+	tests := []struct {
+		name        string
+		renditions  []string
+		wantDeletes []string
+		wantPrefix  bool
+	}{
+		{"recorded", []string{key + "_32_png", key + "_0_svg"}, []string{key, key + "_32_png", key + "_0_svg"}, false},
+		{"none", []string{}, []string{key}, false},
+		{"unknown", nil, []string{key}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			local, err := storage.NewLocal(t.TempDir(), "/objects")
+			if err != nil {
+				t.Fatalf("NewLocal: %v", err)
+			}
+			ctx := context.Background()
+			for _, k := range []string{key, key + "_32_png", key + "_0_svg"} {
+				if _, err := local.Put(ctx, k, []byte(k), "image/png"); err != nil {
+					t.Fatalf("Put %s: %v", k, err)
+				}
+			}
+			objects := &recordingStore{ObjectStore: local}
+			s := &Server{Store: objects}
+
+			if err := s.deleteBlobObjects(ctx, key, tt.renditions); err != nil {
+				t.Fatalf("deleteBlobObjects: %v", err)
+			}
+			if !slices.Equal(objects.deletes, tt.wantDeletes) {
+				t.Errorf("deletes = %v, want %v", objects.deletes, tt.wantDeletes)
+			}
+			if got := len(objects.prefixes) > 0; got != tt.wantPrefix {
+				t.Errorf("prefix deletes = %v, want any: %v", objects.prefixes, tt.wantPrefix)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package httpx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// etag returns a strong validator for the stored icon record. It changes
+// whenever the icon is re-stored (new URL, key or update time).
+func (e iconEntry) etag() string {
+	h := sha256.New()
+	h.Write([]byte(e.URL))
+	h.Write([]byte{0})
+	h.Write([]byte(e.Key))
+	h.Write([]byte{0})
+	if !e.UpdatedAt.IsZero() {
+		h.Write([]byte(strconv.FormatInt(e.UpdatedAt.UnixNano(), 10)))
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// setValidators sets ETag and, when known, Last-Modified.
+func setValidators(w http.ResponseWriter, etag string, modified time.Time) {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// writeNotModified evaluates If-None-Match / If-Modified-Since (RFC 9110
+// §13.2.2) against the ETag and Last-Modified already set on w. If the
+// client's copy is current it writes 304 and returns true.
+func writeNotModified(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	h := w.Header()
+
+	matched := false
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		// If-None-Match takes precedence; If-Modified-Since is then ignored.
+		matched = etagListMatches(inm, h.Get("ETag"))
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		since, err1 := http.ParseTime(ims)
+		modified, err2 := http.ParseTime(h.Get("Last-Modified"))
+		matched = err1 == nil && err2 == nil && !modified.After(since)
+	}
+	if !matched {
+		return false
+	}
+
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Location")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagListMatches reports whether the If-None-Match header list contains
+// etag, using weak comparison as required for If-None-Match.
+func etagListMatches(list, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tok := range strings.Split(list, ",") {
+		tok = strings.TrimSpace(tok)
+		if tok == "*" || strings.TrimPrefix(tok, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package httpx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestWriteNotModified covers If-None-Match / If-Modified-Since evaluation
+// against validators derived from a stored icon entry.
+func TestWriteNotModified(t *testing.T) {
+	t.Parallel()
+
+	updated := time.Date(2025, 3, 1, 12, 0, 0, 500, time.UTC)
+	e := iconEntry{URL: "https://cdn.example/icon.png", Key: "favget/example.com/abc", UpdatedAt: updated}
+	etag := e.etag()
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want304 bool
+	}{
+		{"no-conditionals", nil, false},
+		{"inm-match", map[string]string{"If-None-Match": etag}, true},
+		{"inm-weak-match", map[string]string{"If-None-Match": "W/" + etag}, true},
+		{"inm-list", map[string]string{"If-None-Match": `"nope", ` + etag}, true},
+		{"inm-star", map[string]string{"If-None-Match": "*"}, true},
+		{"inm-mismatch", map[string]string{"If-None-Match": `"stale"`}, false},
+		{"ims-equal", map[string]string{"If-Modified-Since": updated.Format(http.TimeFormat)}, true},
+		{"ims-later", map[string]string{"If-Modified-Since": updated.Add(time.Hour).Format(http.TimeFormat)}, true},
+		{"ims-earlier", map[string]string{"If-Modified-Since": updated.Add(-time.Hour).Format(http.TimeFormat)}, false},
+		// If-None-Match wins even when If-Modified-Since alone would match.
+		{"inm-overrides-ims", map[string]string{
+			"If-None-Match":     `"stale"`,
+			"If-Modified-Since": updated.Add(time.Hour).Format(http.TimeFormat),
+		}, false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, "/v1/icon?domain=example.com", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			setValidators(w, etag, e.UpdatedAt)
+
+			got := writeNotModified(w, r)
+			if got != tt.want304 {
+				t.Fatalf("writeNotModified = %v, want %v", got, tt.want304)
+			}
+			if got && w.Code != http.StatusNotModified {
+				t.Fatalf("status = %d, want 304", w.Code)
+			}
+		})
+	}
+}
+
+// TestIconEntryETagChangesOnUpdate ensures a re-stored icon gets a new validator.
+func TestIconEntryETagChangesOnUpdate(t *testing.T) {
+	t.Parallel()
+
+	a := iconEntry{URL: "u", Key: "k", UpdatedAt: time.Unix(100, 0)}
+	b := a
+	b.UpdatedAt = time.Unix(200, 0)
+	if a.etag() == b.etag() {
+		t.Fatalf("etag did not change with UpdatedAt")
+	}
+	if a.etag() != a.etag() {
+		t.Fatalf("etag is not deterministic")
+	}
+}
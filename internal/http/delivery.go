@@ -0,0 +1,172 @@
+package httpx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	imagex "github.com/kudanilll/favget/internal/image"
+	"github.com/kudanilll/favget/internal/storage"
+	"github.com/kudanilll/favget/internal/store"
+)
+
+// Delivery modes for /v1/icon.
+const (
+	ModeRedirect = "redirect" // 302 to the storage backend URL
+	ModeProxy    = "proxy"    // stream the stored bytes from Favget's own origin
+)
+
+const iconCacheControl = "public, max-age=86400, stale-while-revalidate=604800"
+
+// maxProxySVGBytes caps how much of a stored SVG is buffered for sanitizing.
+const maxProxySVGBytes = 1 << 20
+
+// iconEntry is the positive-cache value stored under icon:<domain>.
+// Older deployments stored the bare URL; decodeIconEntry accepts both.
+type iconEntry struct {
+	URL         string    `json:"url"`
+	Key         string    `json:"key,omitempty"` // ObjectStore key; needed for proxy mode
+	ContentType string    `json:"ct,omitempty"`
+	UpdatedAt   time.Time `json:"t,omitempty"`
+	CheckedAt   time.Time `json:"c,omitempty"` // last resolve or revalidation; drives soft/hard TTLs
+}
+
+func (e iconEntry) encode() string {
+	b, _ := json.Marshal(e)
+	return string(b)
+}
+
+func decodeIconEntry(v string) (iconEntry, bool) {
+	if v == "" {
+		return iconEntry{}, false
+	}
+	if !strings.HasPrefix(v, "{") {
+		return iconEntry{URL: v}, true // legacy plain URL
+	}
+	var e iconEntry
+	if err := json.Unmarshal([]byte(v), &e); err != nil || e.URL == "" {
+		return iconEntry{}, false
+	}
+	return e, true
+}
+
+// entryFromRecord rebuilds a cache entry from a persisted icon row. Rows
+// written before content-addressed storage have no hash and point at the
+// per-domain object.
+func entryFromRecord(rec *store.IconRecord) iconEntry {
+	e := iconEntry{
+		URL:       rec.IconURL,
+		Key:       storage.ObjectKey(rec.Domain, rec.SourceURL),
+		UpdatedAt: rec.UpdatedAt,
+		CheckedAt: rec.CheckedAt,
+	}
+	if rec.ContentHash != nil {
+		e.Key = storage.BlobKey(*rec.ContentHash)
+	}
+	if rec.ContentType != nil {
+		e.ContentType = *rec.ContentType
+	}
+	return e
+}
+
+// deliveryMode returns the mode requested via ?mode=, falling back to the
+// deployment default. ok is false for an unknown mode.
+func (s *Server) deliveryMode(r *http.Request) (string, bool) {
+	switch m := strings.ToLower(r.URL.Query().Get("mode")); m {
+	case "":
+		if s.DefaultMode == ModeProxy {
+			return ModeProxy, true
+		}
+		return ModeRedirect, true
+	case ModeRedirect, ModeProxy:
+		return m, true
+	}
+	return "", false
+}
+
+// respondIcon writes the final /v1/icon response for entry in the given mode.
+// Validators are derived from the stored record, so a client revalidating
+// with If-None-Match / If-Modified-Since gets 304 without touching storage.
+func (s *Server) respondIcon(ctx context.Context, w http.ResponseWriter, r *http.Request, e iconEntry, mode string) {
+	w.Header().Set("Cache-Control", iconCacheControl)
+	setValidators(w, e.etag(), e.UpdatedAt)
+	if writeNotModified(w, r) {
+		return
+	}
+	if mode == ModeProxy {
+		s.streamObject(ctx, w, r, e.Key, iconCacheControl)
+		return
+	}
+	http.Redirect(w, r, e.URL, http.StatusFound)
+}
+
+// streamObject copies an object from the ObjectStore to w with the headers a
+// browser needs to cache it: Content-Type, Content-Length, ETag,
+// Last-Modified and Cache-Control.
+func (s *Server) streamObject(ctx context.Context, w http.ResponseWriter, r *http.Request, key, cacheControl string) {
+	body, info, err := s.Store.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("object read failed for %s: %v", key, err)
+		http.Error(w, "storage unavailable", http.StatusBadGateway)
+		return
+	}
+	defer body.Close()
+
+	var svg []byte
+	if strings.HasPrefix(info.ContentType, imagex.FormatSVG.MIME()) {
+		// Objects stored before sanitization existed may still carry scripts,
+		// so SVG is re-sanitized on every read rather than streamed verbatim.
+		raw, err := io.ReadAll(io.LimitReader(body, maxProxySVGBytes+1))
+		if err == nil && len(raw) > maxProxySVGBytes {
+			err = errors.New("svg too large")
+		}
+		if err == nil {
+			svg, err = imagex.SanitizeSVG(raw)
+		}
+		if err != nil {
+			log.Printf("unsafe svg object %s: %v", key, err)
+			http.Error(w, "icon unavailable", http.StatusBadGateway)
+			return
+		}
+		info.Size = int64(len(svg))
+	}
+
+	// Icon bytes come from third-party sites; never let them run as a document.
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	if info.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	// Validators already set by the caller (from the icon record) win over
+	// whatever the backend reports.
+	if w.Header().Get("ETag") == "" && info.ETag != "" {
+		w.Header().Set("ETag", info.ETag)
+	}
+	if w.Header().Get("Last-Modified") == "" && !info.LastModified.IsZero() {
+		w.Header().Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+	if writeNotModified(w, r) {
+		return
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	if svg != nil {
+		_, _ = w.Write(svg)
+		return
+	}
+	_, _ = io.Copy(w, body)
+}
@@ -0,0 +1,166 @@
+package httpx
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kudanilll/favget/internal/storage"
+)
+
+// newDeliveryServer returns a Server backed by a local store holding a PNG,
+// an SVG with a script, and an SVG that cannot be sanitized.
+func newDeliveryServer(t *testing.T) (*Server, []byte) {
+	t.Helper()
+
+	objects, err := storage.NewLocal(t.TempDir(), "/objects")
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	for key, data := range map[string][]byte{
+		"icons/a.png":   buf.Bytes(),
+		"icons/a.svg":   []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script><rect width="1"/></svg>`),
+		"icons/bad.svg": []byte(`<svg xmlns="http://www.w3.org/2000/svg"><rect>`),
+	} {
+		if _, err := objects.Put(context.Background(), key, data, ""); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+	}
+	return &Server{Store: objects}, buf.Bytes()
+}
+
+func TestRespondIcon(t *testing.T) {
+	t.Parallel()
+
+	s, pngData := newDeliveryServer(t)
+	updated := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	entry := func(key string) iconEntry {
+		return iconEntry{URL: "https://cdn.example/" + key, Key: key, UpdatedAt: updated}
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		entry       iconEntry
+		mode        string
+		inm         bool // send If-None-Match with the entry's ETag
+		wantStatus  int
+		wantType    string
+		wantBody    string // exact body, when set
+		wantDropped string // substring the body must not contain
+	}{
+		{name: "redirect", entry: entry("icons/a.png"), mode: ModeRedirect, wantStatus: http.StatusFound},
+		{name: "proxy-png", entry: entry("icons/a.png"), mode: ModeProxy, wantStatus: http.StatusOK, wantType: "image/png", wantBody: string(pngData)},
+		{name: "proxy-head", method: http.MethodHead, entry: entry("icons/a.png"), mode: ModeProxy, wantStatus: http.StatusOK, wantType: "image/png"},
+		{name: "proxy-not-modified", entry: entry("icons/a.png"), mode: ModeProxy, inm: true, wantStatus: http.StatusNotModified},
+		{name: "redirect-not-modified", entry: entry("icons/a.png"), mode: ModeRedirect, inm: true, wantStatus: http.StatusNotModified},
+		{name: "proxy-svg-resanitized", entry: entry("icons/a.svg"), mode: ModeProxy, wantStatus: http.StatusOK, wantType: "image/svg+xml", wantDropped: "script"},
+		{name: "proxy-unsafe-svg", entry: entry("icons/bad.svg"), mode: ModeProxy, wantStatus: http.StatusBadGateway},
+		{name: "proxy-missing", entry: entry("icons/missing.png"), mode: ModeProxy, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "/v1/icon?domain=example.com", nil)
+			if tt.inm {
+				r.Header.Set("If-None-Match", tt.entry.etag())
+			}
+			w := httptest.NewRecorder()
+			s.respondIcon(r.Context(), w, r, tt.entry, tt.mode)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			h := w.Header()
+			if w.Code == http.StatusFound && h.Get("Location") != tt.entry.URL {
+				t.Errorf("Location = %q, want %q", h.Get("Location"), tt.entry.URL)
+			}
+			if w.Code >= 400 {
+				return
+			}
+			// Validators come from the entry on every path, including 304s.
+			if h.Get("ETag") != tt.entry.etag() || h.Get("Last-Modified") != updated.Format(http.TimeFormat) {
+				t.Errorf("validators = %q, %q; want the entry's", h.Get("ETag"), h.Get("Last-Modified"))
+			}
+			if h.Get("Cache-Control") != iconCacheControl {
+				t.Errorf("Cache-Control = %q", h.Get("Cache-Control"))
+			}
+			if w.Code == http.StatusNotModified {
+				if w.Body.Len() != 0 {
+					t.Errorf("304 with body %q", w.Body.String())
+				}
+				return
+			}
+			if tt.mode != ModeProxy {
+				return
+			}
+
+			if !strings.HasPrefix(h.Get("Content-Type"), tt.wantType) {
+				t.Errorf("Content-Type = %q, want %s", h.Get("Content-Type"), tt.wantType)
+			}
+			if !strings.Contains(h.Get("Content-Security-Policy"), "sandbox") {
+				t.Errorf("Content-Security-Policy = %q, want a sandbox", h.Get("Content-Security-Policy"))
+			}
+			n, err := strconv.Atoi(h.Get("Content-Length"))
+			if err != nil {
+				t.Fatalf("Content-Length = %q", h.Get("Content-Length"))
+			}
+			if method == http.MethodHead {
+				if w.Body.Len() != 0 || n != len(pngData) {
+					t.Errorf("HEAD: body %d bytes, Content-Length %d; want 0 and %d", w.Body.Len(), n, len(pngData))
+				}
+				return
+			}
+			if n != w.Body.Len() {
+				t.Errorf("Content-Length = %d, body has %d bytes", n, w.Body.Len())
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body differs from the stored object")
+			}
+			if tt.wantDropped != "" && strings.Contains(w.Body.String(), tt.wantDropped) {
+				t.Errorf("body still contains %q: %s", tt.wantDropped, w.Body.String())
+			}
+		})
+	}
+}
+
+// TestStreamObjectBackendValidators checks that without validators from an
+// icon record (as for /objects/*), the backend's ETag and Last-Modified are
+// passed through and honoured.
+func TestStreamObjectBackendValidators(t *testing.T) {
+	t.Parallel()
+
+	s, _ := newDeliveryServer(t)
+	r := httptest.NewRequest(http.MethodGet, "/objects/icons/a.png", nil)
+	w := httptest.NewRecorder()
+	s.streamObject(r.Context(), w, r, "icons/a.png", "public, max-age=86400")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Header().Get("Last-Modified") == "" {
+		t.Fatalf("status %d, ETag %q, Last-Modified %q; want 200 with validators", w.Code, etag, w.Header().Get("Last-Modified"))
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/objects/icons/a.png", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	s.streamObject(r.Context(), w, r, "icons/a.png", "public, max-age=86400")
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("revalidation: status %d, %d body bytes; want an empty 304", w.Code, w.Body.Len())
+	}
+}
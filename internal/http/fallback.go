@@ -0,0 +1,91 @@
+package httpx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	imagex "github.com/kudanilll/favget/internal/image"
+)
+
+// FallbackLetter is the only fallback style: a letter monogram on a colour
+// derived from the domain.
+const FallbackLetter = "letter"
+
+// fallbackCacheControl is short so a site that adds an icon later is picked
+// up soon; the placeholder itself is cheap to regenerate.
+const fallbackCacheControl = "public, max-age=3600"
+
+// defaultFallbackSize is the raster size when the request has no size=.
+const defaultFallbackSize = 64
+
+// parseFallback validates ?fallback=. Empty means "respond 404".
+func parseFallback(r *http.Request) (string, bool) {
+	switch f := strings.ToLower(r.URL.Query().Get("fallback")); f {
+	case "", FallbackLetter:
+		return f, true
+	}
+	return "", false
+}
+
+// iconNotFound answers a failed lookup with a problem+json document
+// describing err (see lookupProblem). With fallback set, the placeholder
+// replaces it only when the site has no icon to serve, i.e. the 404 outcomes,
+// whether fresh or from the negative cache. Refusals (blocked_address) and
+// upstream, storage or database failures keep their problem document, so a
+// placeholder never hides an outage or a policy decision.
+func (s *Server) iconNotFound(w http.ResponseWriter, r *http.Request, domain string, v variant, fallback string, err error) {
+	p := lookupProblem(domain, err)
+	if fallback == FallbackLetter && p.Status == http.StatusNotFound {
+		s.respondFallback(w, r, domain, v)
+		return
+	}
+	writeProblem(w, p)
+}
+
+// respondFallback serves the generated placeholder for domain instead of a
+// 404. The placeholder is never stored; it is rendered per request in the
+// requested format (SVG unless format= asks for a raster) and served
+// directly whatever the delivery mode.
+func (s *Server) respondFallback(w http.ResponseWriter, r *http.Request, domain string, v variant) {
+	a := imagex.LetterAvatar(domain)
+
+	f := v.Format
+	if f == "" {
+		f = imagex.FormatSVG
+	}
+	size := v.Size
+	if size == 0 {
+		size = defaultFallbackSize
+	}
+
+	var data []byte
+	if f == imagex.FormatSVG {
+		data = a.SVG(size)
+	} else {
+		img, err := a.Image(size)
+		if err == nil {
+			data, err = imagex.Encode(img, f)
+		}
+		if err != nil {
+			http.Error(w, "fallback unavailable", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	sum := sha256.Sum256(data)
+	w.Header().Set("Cache-Control", fallbackCacheControl)
+	w.Header().Set("X-Favget-Fallback", FallbackLetter)
+	setValidators(w, `"`+hex.EncodeToString(sum[:16])+`"`, time.Time{})
+	if writeNotModified(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", f.MIME())
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,105 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	imagex "github.com/kudanilll/favget/internal/image"
+	"github.com/kudanilll/favget/internal/resolver"
+)
+
+func TestIconNotFoundFallback(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{}
+	tests := []struct {
+		name       string
+		v          variant
+		fallback   string
+		wantStatus int
+		wantType   string
+	}{
+		{"no-fallback", variant{}, "", http.StatusNotFound, "application/problem+json"},
+		{"letter-svg", variant{}, FallbackLetter, http.StatusOK, "image/svg+xml"},
+		{"letter-png", variant{32, imagex.FormatPNG}, FallbackLetter, http.StatusOK, "image/png"},
+		{"letter-ico", variant{0, imagex.FormatICO}, FallbackLetter, http.StatusOK, "image/x-icon"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, "/v1/icon?domain=example.com", nil)
+			w := httptest.NewRecorder()
+			s.iconNotFound(w, r, "example.com", tt.v, tt.fallback, errIconNotFound)
+			if w.Code != tt.wantStatus || w.Header().Get("Content-Type") != tt.wantType {
+				t.Fatalf("got %d %q, want %d %q", w.Code, w.Header().Get("Content-Type"), tt.wantStatus, tt.wantType)
+			}
+			if tt.fallback == "" {
+				return
+			}
+			if w.Header().Get("X-Favget-Fallback") != FallbackLetter {
+				t.Fatalf("missing X-Favget-Fallback header")
+			}
+
+			// Same placeholder, same ETag: revalidation yields 304.
+			r2 := httptest.NewRequest(http.MethodGet, "/v1/icon?domain=example.com", nil)
+			r2.Header.Set("If-None-Match", w.Header().Get("ETag"))
+			w2 := httptest.NewRecorder()
+			s.iconNotFound(w2, r2, "example.com", tt.v, tt.fallback, errIconNotFound)
+			if w2.Code != http.StatusNotModified {
+				t.Fatalf("revalidation status = %d, want 304", w2.Code)
+			}
+		})
+	}
+}
+
+// TestIconNotFoundFallbackScope checks that the placeholder stands in only
+// for "no icon" outcomes, never for refusals or failures.
+func TestIconNotFoundFallbackScope(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{}
+	cached := func(reason resolver.Reason) error {
+		return &resolver.Error{Domain: "example.com", Reason: reason, Err: errNegativeCached}
+	}
+	tests := []struct {
+		name         string
+		err          error
+		wantFallback bool
+		wantStatus   int
+	}{
+		{"not-found", errIconNotFound, true, http.StatusOK},
+		{"all-rejected", &resolver.Error{Domain: "example.com", Reason: resolver.ReasonAllRejected}, true, http.StatusOK},
+		{"no-candidates-cached", cached(resolver.ReasonNoCandidates), true, http.StatusOK},
+		{"dns-cached", cached(resolver.ReasonDNS), true, http.StatusOK},
+		{"blocked", &resolver.Error{Domain: "example.com", Reason: resolver.ReasonBlockedAddress, Err: resolver.ErrBlockedAddress}, false, http.StatusForbidden},
+		{"blocked-cached", cached(resolver.ReasonBlockedAddress), false, http.StatusForbidden},
+		{"storage", errStorage, false, http.StatusBadGateway},
+		{"database", errors.New("pgx: connection refused"), false, http.StatusBadGateway},
+		{"timeout", context.DeadlineExceeded, false, http.StatusGatewayTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, "/v1/icon?domain=example.com&fallback=letter", nil)
+			w := httptest.NewRecorder()
+			s.iconNotFound(w, r, "example.com", variant{}, FallbackLetter, tt.err)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("X-Favget-Fallback") == FallbackLetter; got != tt.wantFallback {
+				t.Fatalf("fallback served = %v, want %v", got, tt.wantFallback)
+			}
+			if !tt.wantFallback && w.Header().Get("Content-Type") != "application/problem+json" {
+				t.Fatalf("Content-Type = %q, want a problem document", w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
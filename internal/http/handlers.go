@@ -14,24 +14,70 @@ import (
 	"golang.org/x/sync/singleflight"
 
 	"github.com/kudanilll/favget/internal/cache"
-	"github.com/kudanilll/favget/internal/cloud"
+	imagex "github.com/kudanilll/favget/internal/image"
 	"github.com/kudanilll/favget/internal/resolver"
+	"github.com/kudanilll/favget/internal/storage"
 	"github.com/kudanilll/favget/internal/store"
 )
 
+var errIconNotFound = errors.New("icon not found")
+
+// resolveTimeout bounds one resolve and upload, which runs detached from the
+// request that started it.
+const resolveTimeout = 15 * time.Second
+
+// IconStore persists icons, their history and the blobs holding their
+// bytes. *store.DB implements it.
+type IconStore interface {
+	FindByDomain(ctx context.Context, domain string) (*store.IconRecord, error)
+	Upsert(ctx context.Context, rec store.IconRecord) (time.Time, error)
+	SetSource(ctx context.Context, domain, sourceURL string, etag *string) error
+	ClaimStale(ctx context.Context, before time.Time, limit int) ([]store.IconRecord, error)
+	ClaimIfStale(ctx context.Context, domain string, before time.Time) (*store.IconRecord, error)
+	Delete(ctx context.Context, domain string) (*store.IconRecord, error)
+	DeleteMatching(ctx context.Context, pattern string) ([]store.IconRecord, error)
+
+	ClaimBlob(ctx context.Context, b store.Blob) (*store.Blob, error)
+	SetBlobLocation(ctx context.Context, hash, key, url string) error
+	AddBlobRendition(ctx context.Context, hash, key string) error
+	SweepOrphanBlobs(ctx context.Context, hashes []string, grace time.Duration, limit int, del func(key string, renditions []string) error) (int, error)
+
+	AddVersion(ctx context.Context, v store.IconVersion) (*store.IconVersion, error)
+	ListVersions(ctx context.Context, domain string, limit int) ([]store.IconVersion, error)
+	DeleteVersions(ctx context.Context, pattern string) ([]store.IconVersion, error)
+	FindVersion(ctx context.Context, id int64) (*store.IconVersion, error)
+}
+
+// IconResolver finds a domain's best icon upstream. *resolver.Resolver
+// implements it.
+type IconResolver interface {
+	ResolveBestIcon(ctx context.Context, target string) (src string, meta resolver.Meta, err error)
+	Revalidate(ctx context.Context, target, prevSrc, prevETag string) (src string, meta resolver.Meta, notModified bool, err error)
+	Inspect(ctx context.Context, target string) (resolver.Report, error)
+}
+
 // Server aggregates all dependencies required by HTTP handlers.
 // Keep it small and explicit so it's easy to test and reason about.
 type Server struct {
-	DB                  *store.DB
-	Cache               *cache.Cache
-	CLD                 *cloud.Cloud
-	Resolver            *resolver.Resolver
-	APIKeys             []string // API keys enforced by middleware; empty means "no auth"
-	AllowedOrigins      []string // allowed CORS origins
-	NegativeCacheTTLSec int      // TTL in seconds for negative cache entries
-	RateLimitRPS        int      // rate limit requests per second per IP; 0 = no limit
+	DB                      IconStore
+	Cache                   cache.Cache
+	Store                   storage.ObjectStore // where icon bytes are stored (Cloudinary, local, S3)
+	ServeObjects            bool                // expose Store objects at /objects/* (local backend)
+	DefaultMode             string              // /v1/icon delivery when ?mode= is absent: "redirect" (default) or "proxy"
+	Resolver                IconResolver
+	APIKeys                 []string // API keys enforced by middleware; empty means "no auth"
+	AdminAPIKeys            []string // keys for /v1/admin/*; empty disables those routes
+	AllowedOrigins          []string // allowed CORS origins
+	NegativeCacheTTLSec     int      // TTL in seconds for "site has no icon" negative cache entries; 0 = default (5m)
+	NegativeTransientTTLSec int      // TTL in seconds for transient failures (timeouts, 5xx); 0 = default (30s)
+	RateLimitRPS            int      // rate limit requests per second per IP; 0 = no limit
+	BatchMaxDomains         int      // max domains per /v1/icons:batch request; 0 = default (500)
+	BatchConcurrency        int      // concurrent lookups per batch request; 0 = default (8)
+	SoftTTLSec              int      // serve icons checked longer ago than this while re-resolving in the background; 0 = never
+	HardTTLSec              int      // block on a re-resolve for icons checked longer ago than this; 0 = never
 
 	singleflight singleflight.Group
+	revalidate   func(ctx context.Context, domain string) (iconEntry, error) // background revalidation; nil = revalidateStored
 }
 
 // CORS middleware for handling cross-origin requests
@@ -43,7 +89,7 @@ func (s *Server) CORS(next http.Handler) http.Handler {
 				w.Header().Set("Access-Control-Allow-Origin", origin)
 				w.Header().Set("Vary", "Origin")
 			}
-			w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
 			w.Header().Set("Access-Control-Allow-Headers", "Authorization, X-API-Key, Content-Type")
 			w.Header().Set("Access-Control-Max-Age", "86400")
 		}
@@ -83,6 +129,11 @@ func (s *Server) Routes() http.Handler {
 		w.WriteHeader(http.StatusOK)
 	})
 
+	// Stored icon objects, for backends without their own public delivery (local).
+	if s.ServeObjects {
+		r.Get("/objects/*", s.handleObject)
+	}
+
 	// Apply CORS middleware to all routes
 	r.With(s.CORS).Group(func(cr chi.Router) {
 
@@ -98,7 +149,31 @@ func (s *Server) Routes() http.Handler {
 
 			// Main icon endpoint
 			sr.Get("/v1/icon", s.handleIcon)
+
+			// Candidate metadata for debugging and client-side selection
+			sr.Get("/v1/icons", s.handleIcons)
+
+			// Many domains in one request; counts once against the rate limit
+			sr.Post("/v1/icons:batch", s.handleBatch)
+
+			// Recorded versions of a domain's icon, and a single historical icon
+			sr.Get("/v1/icons/history", s.handleHistory)
+			sr.Get("/v1/icons/history/{id}", s.handleHistoryVersion)
 		})
+
+		// --- Admin endpoints (separate keys; not mounted without them) ---
+		if len(s.AdminAPIKeys) > 0 {
+			cr.Group(func(ar chi.Router) {
+				ar.Use(APIKeyAuth(s.AdminAPIKeys))
+
+				// Evict cached/stored icons by domain, pattern or all
+				ar.Post("/v1/admin/purge", s.handlePurge)
+				ar.Delete("/v1/admin/icons/{domain}", s.handlePurgeDomain)
+
+				// Cache hit/miss counters of this instance
+				ar.Get("/v1/admin/stats", s.handleStats)
+			})
+		}
 	})
 
 	return r
@@ -145,9 +220,23 @@ func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 				Method:      "GET",
 				Path:        "/v1/icon",
 				Auth:        "required (API key)",
-				Description: "Resolve best icon for a domain and redirect to optimized Cloudinary URL",
+				Description: "Resolve best icon for a domain and redirect to (or proxy) the stored icon; optional size= and format= renditions",
 				Example:     `curl -i "https://<host>/v1/icon?domain=github.com" -H "Authorization: Bearer <API_KEY>"`,
 			},
+			{
+				Method:      "POST",
+				Path:        "/v1/icons:batch",
+				Auth:        "required (API key)",
+				Description: "Resolve icons for many domains at once; returns per-domain URL, status and error",
+				Example:     `curl -X POST "https://<host>/v1/icons:batch" -H "Authorization: Bearer <API_KEY>" -d '{"domains":["github.com","go.dev"]}'`,
+			},
+			{
+				Method:      "GET",
+				Path:        "/v1/icons/history",
+				Auth:        "required (API key)",
+				Description: "List every recorded version of a domain's icon; fetch one at /v1/icons/history/{id}",
+				Example:     `curl "https://<host>/v1/icons/history?domain=github.com" -H "Authorization: Bearer <API_KEY>"`,
+			},
 		},
 	}
 
@@ -208,15 +297,12 @@ func (s *Server) setSecurityHeaders(w http.ResponseWriter) {
 	w.Header().Set("Permissions-Policy", "geolocation=(), microphone=(), camera=()")
 }
 
-// handleIcon resolves the best icon for the given domain, uploads (remote fetch)
-// to Cloudinary, persists metadata in Postgres, caches the result in Redis,
-// and finally issues a 302 redirect to the Cloudinary URL.
-//
-// Cache strategy:
-//   - Redis GET first (hot path).
-//   - DB lookup second (warm path) with backfill into Redis.
-//   - Resolve + Upload + Upsert + Cache on miss (cold path).
-//   - Negative cache for misses to avoid repeated upstream lookups.
+// handleIcon resolves the best icon for the given domain, stores its bytes in
+// the configured ObjectStore, persists metadata in Postgres, caches the result
+// in Redis, and finally responds according to the delivery mode: a 302
+// redirect to the stored object's URL, or (mode=proxy) the bytes themselves.
+// With size= and/or format=, a derived rendition is served instead (see handleVariant).
+// With fallback=letter, a generated placeholder replaces a 404 (see iconNotFound).
 func (s *Server) handleIcon(w http.ResponseWriter, r *http.Request) {
 	s.setSecurityHeaders(w)
 	domain := r.URL.Query().Get("domain")
@@ -225,93 +311,198 @@ func (s *Server) handleIcon(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid domain", http.StatusBadRequest)
 		return
 	}
+	mode, ok := s.deliveryMode(r)
+	if !ok {
+		http.Error(w, "invalid mode", http.StatusBadRequest)
+		return
+	}
+	v, err := parseVariant(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fallback, ok := parseFallback(r)
+	if !ok {
+		http.Error(w, "invalid fallback", http.StatusBadRequest)
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	// 1) Redis (hot path) — positive cache
-	if u, err := s.Cache.Get(ctx, "icon:"+domain); err == nil && u != "" {
-		w.Header().Set("Cache-Control", "public, max-age=86400, stale-while-revalidate=604800")
-		http.Redirect(w, r, u, http.StatusFound)
+	if v != (variant{}) {
+		s.handleVariant(ctx, w, r, domain, v, mode, fallback)
 		return
 	}
 
-	// 1b) Redis — negative cache (icon was previously not found)
-	if u, err := s.Cache.Get(ctx, "icon-miss:"+domain); err == nil && u == "1" {
-		http.Error(w, "icon not found", http.StatusNotFound)
+	e, err := s.lookupIcon(ctx, domain, mode == ModeProxy)
+	if err != nil {
+		s.iconNotFound(w, r, domain, v, fallback, err)
 		return
 	}
+	s.respondIcon(ctx, w, r, e, mode)
+}
+
+// lookupIcon returns the stored icon for domain, resolving it if needed.
+// needKey forces a fall-through past legacy cache entries that lack a storage key.
+//
+// Cache strategy:
+//   - Redis GET first (hot path).
+//   - DB lookup second (warm path) with backfill into Redis.
+//   - Resolve + Upload + Upsert + Cache on miss (cold path).
+//   - Negative cache for misses to avoid repeated upstream lookups, with a
+//     TTL per failure class (see negativeTTL).
+//
+// Stored icons past the soft TTL are still served, and re-resolved in the
+// background (see usableEntry). Only icons past the hard TTL, or domains with
+// nothing stored, wait for a resolve; if that fails, a hard-expired icon is
+// served anyway.
+func (s *Server) lookupIcon(ctx context.Context, domain string, needKey bool) (iconEntry, error) {
+	var old *iconEntry // usable only if a resolve fails
+
+	// 1) Cache (hot path) — positive cache
+	if v, err := s.Cache.Get(ctx, "icon:"+domain); err == nil {
+		if e, ok := decodeIconEntry(v); ok && (!needKey || e.Key != "") {
+			if s.usableEntry(domain, e) {
+				return e, nil
+			}
+			old = &e
+		}
+	}
+
+	// 1b) Cache — negative cache (a recent lookup failed; carries its reason)
+	if old == nil {
+		if err := s.cachedMiss(ctx, domain); err != nil {
+			return iconEntry{}, err
+		}
+	}
 
 	// 2) DB (warm path)
 	if rec, err := s.DB.FindByDomain(ctx, domain); err == nil && rec.IconURL != "" {
-		_ = s.Cache.Set(ctx, "icon:"+domain, rec.IconURL)
-		w.Header().Set("Cache-Control", "public, max-age=86400, stale-while-revalidate=604800")
-		http.Redirect(w, r, rec.IconURL, http.StatusFound)
-		return
+		e := entryFromRecord(rec)
+		_ = s.Cache.Set(ctx, "icon:"+domain, e.encode())
+		if s.usableEntry(domain, e) {
+			return e, nil
+		}
+		old = &e
 	}
 
 	// 3) Resolve → Upload → Upsert → Cache (cold path)
 	// Use singleflight to prevent duplicate concurrent resolves for the same domain.
-	iconURL, err := s.resolveAndUpload(domain, ctx)
+	e, err := s.resolveAndUpload(domain, ctx)
 	if err != nil {
-		// Cache the miss to avoid repeated upstream lookups.
-		if s.Cache != nil {
-			negTTL := time.Duration(s.NegativeCacheTTLSec) * time.Second
-			if negTTL <= 0 {
-				negTTL = 5 * time.Minute
-			}
-			_ = s.Cache.SetWithTTL(ctx, "icon-miss:"+domain, "1", negTTL)
+		if old != nil {
+			log.Printf("resolve failed for %s, serving expired icon: %v", domain, err)
+			return *old, nil
 		}
-		http.Error(w, "icon not found", http.StatusNotFound)
-		return
+		log.Printf("resolve failed for %s: %v", domain, err)
+		if ctx.Err() == nil {
+			// Only cache outcomes: a caller that gave up says nothing about the site.
+			s.cacheMiss(ctx, domain, err)
+		}
+		return iconEntry{}, err
 	}
-
-	// Final response
-	w.Header().Set("Cache-Control", "public, max-age=86400, stale-while-revalidate=604800")
-	http.Redirect(w, r, iconURL, http.StatusFound)
+	return e, nil
 }
 
 // resolveAndUpload deduplicates concurrent requests for the same domain using singleflight,
-// then resolves the icon, uploads to Cloudinary, persists metadata, and caches the result.
-func (s *Server) resolveAndUpload(domain string, ctx context.Context) (string, error) {
-	// Create a detached context for the background work so that if the initial caller
-	// cancels their request, it doesn't abort the work for other singleflight waiters.
-	bgCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 15*time.Second)
-	
-	v, err, _ := s.singleflight.Do("icon:"+domain, func() (interface{}, error) {
+// then resolves the icon, stores it, persists metadata, and caches the result.
+// It stops waiting when ctx is done; the work itself carries on for other waiters.
+func (s *Server) resolveAndUpload(domain string, ctx context.Context) (iconEntry, error) {
+	ch := s.singleflight.DoChan("icon:"+domain, func() (interface{}, error) {
+		// Use a detached context for the work so that if the initial caller
+		// cancels their request, it doesn't abort the work for other singleflight waiters.
+		bgCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), resolveTimeout)
 		defer cancel()
 		src, meta, err := s.Resolver.ResolveBestIcon(bgCtx, domain)
 		if err != nil {
 			return nil, err
 		}
+		return s.storeIcon(bgCtx, domain, src, meta)
+	})
 
-		cldURL, err := s.CLD.UploadRemote(bgCtx, domain, src)
-		if err != nil {
-			log.Printf("upload failed for %s: %v", domain, err)
-			return nil, errors.New("upload failed")
+	select {
+	case <-ctx.Done():
+		return iconEntry{}, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return iconEntry{}, res.Err
 		}
+		return res.Val.(iconEntry), nil
+	}
+}
 
-		// Persist metadata (best-effort; the redirect should not depend on these writes)
-		_ = s.DB.Upsert(bgCtx, store.IconRecord{
-			Domain:      domain,
-			IconURL:     cldURL,
-			SourceURL:   meta.SourceURL,
-			ETag:        meta.ETag,
-			ContentType: meta.ContentType,
-		})
+// storeIcon uploads the resolved icon, persists its metadata and refreshes
+// the positive cache. ICO sources are stored as their largest entry in PNG.
+// Bytes are stored once under their content hash, however many domains or
+// history versions use them.
+func (s *Server) storeIcon(ctx context.Context, domain, src string, meta resolver.Meta) (iconEntry, error) {
+	data, contentType, meta := s.storableIcon(meta)
 
-		// Backfill cache
-		_ = s.Cache.Set(bgCtx, "icon:"+domain, cldURL)
+	hash := contentHash(data)
+	key, iconURL, err := s.storeBlob(ctx, hash, data, contentType)
+	if err != nil {
+		log.Printf("upload failed for %s: %v", domain, err)
+		return iconEntry{}, errStorage
+	}
 
-		return cldURL, nil
+	// Persist metadata (best-effort; the redirect should not depend on these writes).
+	// The DB's updated_at is reused in the cache entry so validators match on both paths;
+	// it stays put when the bytes are unchanged.
+	updatedAt, err := s.DB.Upsert(ctx, store.IconRecord{
+		Domain:      domain,
+		IconURL:     iconURL,
+		SourceURL:   displayURL(meta.SourceURL),
+		ETag:        meta.ETag,
+		Width:       meta.Width,
+		Height:      meta.Height,
+		ContentType: meta.ContentType,
+		ContentHash: &hash,
 	})
-	
-	if err == nil {
-		cancel() // If we returned from a cache hit in singleflight or another goroutine did the work
-	}
-	
+	checkedAt := time.Now().Truncate(time.Microsecond)
 	if err != nil {
-		return "", err
+		updatedAt = checkedAt
+	} else {
+		s.recordVersion(ctx, domain, hash, key, iconURL, meta)
+	}
+
+	// Backfill cache
+	e := iconEntry{URL: iconURL, Key: key, ContentType: contentType, UpdatedAt: updatedAt, CheckedAt: checkedAt}
+	_ = s.Cache.Set(ctx, "icon:"+domain, e.encode())
+
+	return e, nil
+}
+
+// storableIcon returns the bytes and content type to store for meta, and
+// meta updated to describe them. SVGs arrive sanitized, or already rendered
+// as PNG with SVG_MODE=rasterize (see resolver.Resolver.RasterizeSVG).
+func (s *Server) storableIcon(meta resolver.Meta) ([]byte, string, resolver.Meta) {
+	// ICO files usually bundle several sizes and browsers/CDNs tend to
+	// render the first (smallest) one. Store the largest entry as PNG instead.
+	data, contentType := meta.Data, ""
+	if meta.ContentType != nil {
+		contentType = *meta.ContentType
+	}
+	if meta.Format == string(imagex.FormatICO) || meta.Format == string(imagex.FormatCUR) {
+		if png, entry, err := imagex.ExtractICO(meta.Data, 0); err == nil {
+			w, h, ct := int32(entry.Width), int32(entry.Height), imagex.FormatPNG.MIME()
+			meta.Width, meta.Height, meta.ContentType = &w, &h, &ct
+			data, contentType = png, ct
+		}
+	}
+	return data, contentType, meta
+}
+
+// handleObject streams an object from the ObjectStore. Icons are stored
+// under their content hash (favget/blobs/<sha256>), so those objects never
+// change. Legacy per-domain keys could be overwritten on re-store, so
+// responses are cached for a day rather than marked immutable.
+func (s *Server) handleObject(w http.ResponseWriter, r *http.Request) {
+	s.setSecurityHeaders(w)
+	key := chi.URLParam(r, "*")
+	if key == "" || strings.Contains(key, "..") {
+		http.NotFound(w, r)
+		return
 	}
-	return v.(string), nil
+	s.streamObject(r.Context(), w, r, key, "public, max-age=86400")
 }
@@ -0,0 +1,145 @@
+package httpx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/kudanilll/favget/internal/resolver"
+	"github.com/kudanilll/favget/internal/store"
+)
+
+// History listing limits for /v1/icons/history.
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+type historyVersion struct {
+	ID          int64     `json:"id"`
+	URL         string    `json:"url"` // Favget path serving this version
+	StorageURL  string    `json:"storage_url"`
+	SourceURL   string    `json:"source_url,omitempty"`
+	ContentHash string    `json:"content_hash"`
+	ContentType *string   `json:"content_type,omitempty"`
+	Width       *int32    `json:"width,omitempty"`
+	Height      *int32    `json:"height,omitempty"`
+	DetectedAt  time.Time `json:"detected_at"`
+}
+
+type historyResponse struct {
+	Domain   string           `json:"domain"`
+	Versions []historyVersion `json:"versions"`
+}
+
+// recordVersion appends the icon just stored for domain to its history if
+// its content differs from the newest version. The version references the
+// same content-addressed blob as the icon, so it stays readable after the
+// icon changes. Like the metadata write it follows, this is best-effort.
+func (s *Server) recordVersion(ctx context.Context, domain, hash, key, url string, meta resolver.Meta) {
+	_, err := s.DB.AddVersion(ctx, store.IconVersion{
+		Domain:      domain,
+		SourceURL:   displayURL(meta.SourceURL),
+		StorageURL:  url,
+		StorageKey:  key,
+		ContentHash: hash,
+		ContentType: meta.ContentType,
+		Width:       meta.Width,
+		Height:      meta.Height,
+	})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("history write failed for %s: %v", domain, err)
+	}
+}
+
+// handleHistory lists the recorded versions of a domain's icon, newest
+// first. It never resolves: a domain without history has no versions.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	s.setSecurityHeaders(w)
+	domain, err := resolver.NormalizeDomain(r.URL.Query().Get("domain"))
+	if err != nil {
+		http.Error(w, "invalid domain", http.StatusBadRequest)
+		return
+	}
+	limit := defaultHistoryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxHistoryLimit {
+			http.Error(w, "invalid limit: must be 1-"+strconv.Itoa(maxHistoryLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	versions, err := s.DB.ListVersions(ctx, domain, limit)
+	if err != nil {
+		log.Printf("history list failed for %s: %v", domain, err)
+		http.Error(w, "history unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	resp := historyResponse{Domain: domain, Versions: make([]historyVersion, 0, len(versions))}
+	for _, v := range versions {
+		resp.Versions = append(resp.Versions, historyVersion{
+			ID:          v.ID,
+			URL:         "/v1/icons/history/" + strconv.FormatInt(v.ID, 10),
+			StorageURL:  v.StorageURL,
+			SourceURL:   displayURL(v.SourceURL), // rows from older versions may hold a whole data: URI
+			ContentHash: v.ContentHash,
+			ContentType: v.ContentType,
+			Width:       v.Width,
+			Height:      v.Height,
+			DetectedAt:  v.DetectedAt,
+		})
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// handleHistoryVersion serves one historical icon, redirected or proxied
+// like /v1/icon (?mode=).
+func (s *Server) handleHistoryVersion(w http.ResponseWriter, r *http.Request) {
+	s.setSecurityHeaders(w)
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id < 1 {
+		http.Error(w, "invalid version id", http.StatusBadRequest)
+		return
+	}
+	mode, ok := s.deliveryMode(r)
+	if !ok {
+		http.Error(w, "invalid mode", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	v, err := s.DB.FindVersion(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("history read failed for version %d: %v", id, err)
+		http.Error(w, "history unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	e := iconEntry{URL: v.StorageURL, Key: v.StorageKey, UpdatedAt: v.DetectedAt}
+	if v.ContentType != nil {
+		e.ContentType = *v.ContentType
+	}
+	s.respondIcon(ctx, w, r, e, mode)
+}
@@ -0,0 +1,85 @@
+package httpx
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kudanilll/favget/internal/cache"
+	"github.com/kudanilll/favget/internal/store"
+)
+
+// TestHistoryValidation covers the request checks that run before the DB.
+func TestHistoryValidation(t *testing.T) {
+	t.Parallel()
+
+	h := (&Server{Cache: cache.New(cache.Options{})}).Routes()
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"no-domain", "/v1/icons/history"},
+		{"bad-domain", "/v1/icons/history?domain=a.com/path"},
+		{"bad-limit", "/v1/icons/history?domain=example.com&limit=0"},
+		{"limit-too-large", "/v1/icons/history?domain=example.com&limit=100000"},
+		{"bad-id", "/v1/icons/history/abc"},
+		{"zero-id", "/v1/icons/history/0"},
+		{"bad-mode", "/v1/icons/history/1?mode=inline"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400 (body %q)", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// versionsDB serves a fixed history.
+type versionsDB struct {
+	IconStore
+	versions []store.IconVersion
+}
+
+func (v versionsDB) ListVersions(ctx context.Context, domain string, limit int) ([]store.IconVersion, error) {
+	return v.versions, nil
+}
+
+// TestHistoryDataSource checks that a data: source recorded by an older
+// version is listed abbreviated, not echoed whole.
+func TestHistoryDataSource(t *testing.T) {
+	t.Parallel()
+
+	src := "data:image/png;base64," + strings.Repeat("A", 4096)
+	db := versionsDB{versions: []store.IconVersion{
+		{ID: 2, Domain: "example.com", SourceURL: src, ContentHash: "h2"},
+		{ID: 1, Domain: "example.com", SourceURL: "https://example.com/favicon.ico", ContentHash: "h1"},
+	}}
+	h := (&Server{DB: db, Cache: cache.New(cache.Options{})}).Routes()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/icons/history?domain=example.com", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %q)", w.Code, w.Body.String())
+	}
+	var resp historyResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := []string{"data:image/png;base64,…(4096 bytes)", "https://example.com/favicon.ico"}
+	if len(resp.Versions) != len(want) {
+		t.Fatalf("versions = %+v, want %d", resp.Versions, len(want))
+	}
+	for i, v := range resp.Versions {
+		if v.SourceURL != want[i] {
+			t.Errorf("versions[%d].source_url = %q, want %q", i, v.SourceURL, want[i])
+		}
+	}
+}
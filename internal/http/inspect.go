@@ -0,0 +1,139 @@
+package httpx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/kudanilll/favget/internal/resolver"
+)
+
+// inspectTimeout bounds one /v1/icons report.
+const inspectTimeout = 15 * time.Second
+
+type candidateProbeJSON struct {
+	OK          bool   `json:"ok"`
+	URL         string `json:"url,omitempty"` // set only when it differs from the candidate URL (HTTPS upgrade)
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	ETag        string `json:"etag,omitempty"`
+	Format      string `json:"format,omitempty"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+type candidateJSON struct {
+	Href    string              `json:"href"`
+	URL     string              `json:"url"`
+	Rel     string              `json:"rel"`
+	Sizes   []string            `json:"sizes,omitempty"`
+	Type    string              `json:"type,omitempty"`
+	Purpose []string            `json:"purpose,omitempty"`
+	Score   int                 `json:"score"`
+	Probe   *candidateProbeJSON `json:"probe,omitempty"`
+}
+
+type iconsResponse struct {
+	Domain     string          `json:"domain"`
+	PageURL    string          `json:"page_url"`
+	Redirects  []string        `json:"redirects,omitempty"`
+	Scheme     string          `json:"scheme"`
+	Chosen     *candidateJSON  `json:"chosen"`
+	Candidates []candidateJSON `json:"candidates"`
+}
+
+// toCandidateJSON converts c for the /v1/icons response. Inline data: URLs
+// are shortened the same way as in problem details (see displayURL).
+func toCandidateJSON(c resolver.Candidate) candidateJSON {
+	out := candidateJSON{
+		Href:    displayURL(c.Href),
+		URL:     displayURL(c.URL),
+		Rel:     c.Rel,
+		Type:    c.Type,
+		Purpose: c.Purpose,
+		Score:   c.Score,
+	}
+	for _, sz := range c.Sizes {
+		out.Sizes = append(out.Sizes, sz.String())
+	}
+	if p := c.Probe; p != nil {
+		out.Probe = &candidateProbeJSON{
+			OK:          p.OK,
+			Status:      p.Status,
+			ContentType: p.ContentType,
+			ETag:        p.ETag,
+			Format:      p.Format,
+			Width:       p.Width,
+			Height:      p.Height,
+			Reason:      string(p.Reason),
+			Error:       p.Err,
+		}
+		if p.URL != c.URL {
+			out.Probe.URL = displayURL(p.URL)
+		}
+	}
+	return out
+}
+
+// handleIcons returns every icon candidate discovered for a domain, each with
+// its probe result, plus the one /v1/icon would choose. It always hits the
+// upstream site and never touches the cache, DB or Cloudinary.
+func (s *Server) handleIcons(w http.ResponseWriter, r *http.Request) {
+	s.setSecurityHeaders(w)
+	domain := r.URL.Query().Get("domain")
+	var err error
+	if domain, err = resolver.NormalizeDomain(domain); err != nil {
+		http.Error(w, "invalid domain", http.StatusBadRequest)
+		return
+	}
+
+	// Probing every candidate can take as long as the server's WriteTimeout.
+	extendWriteDeadline(w, inspectTimeout)
+	ctx, cancel := context.WithTimeout(r.Context(), inspectTimeout)
+	defer cancel()
+
+	rep, err := s.Resolver.Inspect(ctx, domain)
+	if err != nil {
+		log.Printf("inspect failed for %s: %v", domain, err)
+		writeProblem(w, lookupProblem(domain, err))
+		return
+	}
+
+	resp := iconsResponse{
+		Domain:     domain,
+		PageURL:    rep.PageURL,
+		Redirects:  rep.Redirects,
+		Scheme:     rep.Scheme,
+		Candidates: make([]candidateJSON, 0, len(rep.Candidates)),
+	}
+	for _, c := range rep.Candidates {
+		resp.Candidates = append(resp.Candidates, toCandidateJSON(c))
+	}
+	if rep.Chosen >= 0 {
+		chosen := resp.Candidates[rep.Chosen]
+		resp.Chosen = &chosen
+	}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, "encoding failed", http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(body)
+
+	// The report is always computed live, so the only validator is the body
+	// itself; clients polling for "did anything change?" can still get 304.
+	w.Header().Set("Cache-Control", "no-cache")
+	setValidators(w, `"`+hex.EncodeToString(sum[:16])+`"`, time.Time{})
+	if writeNotModified(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, _ = w.Write(append(body, '\n'))
+}
@@ -0,0 +1,32 @@
+package httpx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kudanilll/favget/internal/resolver"
+)
+
+func TestToCandidateJSONElidesDataURIs(t *testing.T) {
+	t.Parallel()
+
+	inline := "data:image/svg+xml;base64," + strings.Repeat("P", 2048)
+	got := toCandidateJSON(resolver.Candidate{
+		Href:  inline,
+		URL:   inline,
+		Rel:   resolver.RelIcon,
+		Probe: &resolver.Probe{OK: true, URL: inline},
+	})
+	const want = "data:image/svg+xml;base64,…(2048 bytes)"
+	if got.Href != want || got.URL != want {
+		t.Fatalf("href, url = %q, %q; want %q", got.Href, got.URL, want)
+	}
+	if got.Probe == nil || got.Probe.URL != "" {
+		t.Fatalf("probe = %+v, want no separate probe URL", got.Probe)
+	}
+
+	plain := toCandidateJSON(resolver.Candidate{Href: "/favicon.ico", URL: "https://example.com/favicon.ico"})
+	if plain.Href != "/favicon.ico" || plain.URL != "https://example.com/favicon.ico" {
+		t.Fatalf("plain candidate changed: %+v", plain)
+	}
+}
@@ -18,7 +18,7 @@ type rateLimitStore struct {
 	rdb   *redis.Client
 	ttl   time.Duration
 	rps   int
-	cache *cache.Cache
+	cache cache.Cache
 }
 
 func (s *rateLimitStore) isRateLimited(ctx context.Context, key string) (bool, error) {
@@ -106,7 +106,7 @@ func APIKeyAuth(keys []string) func(next http.Handler) http.Handler {
 	}
 }
 
-func RateLimitMiddleware(c *cache.Cache, rps int) func(next http.Handler) http.Handler {
+func RateLimitMiddleware(c cache.Cache, rps int) func(next http.Handler) http.Handler {
 	rdb := getRedisClient(c)
 	ttl := time.Minute
 
@@ -151,11 +151,11 @@ func RateLimitMiddleware(c *cache.Cache, rps int) func(next http.Handler) http.H
 	}
 }
 
-func getRedisClient(c *cache.Cache) *redis.Client {
+func getRedisClient(c cache.Cache) *redis.Client {
 	if c == nil {
 		return nil
 	}
-	return c.GetRedisClient()
+	return cache.RedisClient(c)
 }
 
 func getClientIP(r *http.Request) string {
@@ -0,0 +1,92 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kudanilll/favget/internal/resolver"
+)
+
+// Negative-cache defaults, used when the Server fields are zero.
+const (
+	defaultNegativeTTL          = 5 * time.Minute
+	defaultNegativeTransientTTL = 30 * time.Second
+)
+
+// errNegativeCached is the cause attached to failures answered from the
+// negative cache.
+var errNegativeCached = errors.New("cached result of a recent lookup")
+
+// negativeKey is where the reason a lookup failed is cached.
+func negativeKey(domain string) string { return "icon-miss:" + domain }
+
+// negativeTTL returns how long a failed lookup is remembered, by failure
+// class:
+//   - the site has no usable icon (or is blocked, or does not resolve):
+//     NegativeCacheTTLSec;
+//   - timeouts, connection and TLS failures, and candidates rejected only
+//     because of those or 5xx responses: NegativeTransientTTLSec;
+//   - our own storage failures and cancelled lookups: not cached.
+func (s *Server) negativeTTL(err error) time.Duration {
+	if errors.Is(err, errStorage) || errors.Is(err, context.Canceled) {
+		return 0
+	}
+	long := time.Duration(s.NegativeCacheTTLSec) * time.Second
+	if long <= 0 {
+		long = defaultNegativeTTL
+	}
+	short := time.Duration(s.NegativeTransientTTLSec) * time.Second
+	if short <= 0 {
+		short = defaultNegativeTransientTTL
+	}
+
+	var re *resolver.Error
+	if !errors.As(err, &re) {
+		return short
+	}
+	if isTransient(re.Reason, 0) {
+		return short
+	}
+	for _, c := range re.Rejected {
+		if isTransient(c.Reason, c.Status) {
+			return short
+		}
+	}
+	return long
+}
+
+// isTransient reports whether a failure is likely to clear up on its own.
+func isTransient(reason resolver.Reason, status int) bool {
+	switch reason {
+	case resolver.ReasonTimeout, resolver.ReasonUnreachable, resolver.ReasonTLS:
+		return true
+	case resolver.ReasonHTTPStatus:
+		return status >= 500 || status == 429
+	}
+	return false
+}
+
+// cacheMiss remembers that domain could not be resolved, storing the reason
+// so later requests can report it.
+func (s *Server) cacheMiss(ctx context.Context, domain string, err error) {
+	ttl := s.negativeTTL(err)
+	if ttl <= 0 || s.Cache == nil {
+		return
+	}
+	reason := lookupProblem(domain, err).Reason
+	_ = s.Cache.SetWithTTL(ctx, negativeKey(domain), string(reason), ttl)
+}
+
+// cachedMiss returns the error for a negative-cache hit, or nil on a miss.
+// Entries written before reasons were stored hold "1".
+func (s *Server) cachedMiss(ctx context.Context, domain string) error {
+	v, err := s.Cache.Get(ctx, negativeKey(domain))
+	switch {
+	case err != nil || v == "":
+		return nil
+	case v == "1":
+		return errIconNotFound
+	}
+	return &resolver.Error{Domain: domain, Reason: resolver.Reason(v), Err: errNegativeCached}
+}
@@ -0,0 +1,74 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kudanilll/favget/internal/cache"
+	"github.com/kudanilll/favget/internal/resolver"
+)
+
+func TestNegativeTTL(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{NegativeCacheTTLSec: 3600, NegativeTransientTTLSec: 30}
+	rejected := func(rs ...resolver.Rejection) error {
+		return &resolver.Error{Domain: "example.com", Reason: resolver.ReasonAllRejected, Rejected: rs}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want time.Duration
+	}{
+		{"no-icon", rejected(resolver.Rejection{Reason: resolver.ReasonUndecodable}, resolver.Rejection{Reason: resolver.ReasonHTTPStatus, Status: 404}), time.Hour},
+		{"no-candidates", &resolver.Error{Reason: resolver.ReasonNoCandidates}, time.Hour},
+		{"blocked", &resolver.Error{Reason: resolver.ReasonBlockedAddress}, time.Hour},
+		{"timeout", &resolver.Error{Reason: resolver.ReasonTimeout}, 30 * time.Second},
+		{"unreachable", &resolver.Error{Reason: resolver.ReasonUnreachable}, 30 * time.Second},
+		{"icon-5xx", rejected(resolver.Rejection{Reason: resolver.ReasonHTTPStatus, Status: 503}), 30 * time.Second},
+		{"icon-timeout", rejected(resolver.Rejection{Reason: resolver.ReasonUndecodable}, resolver.Rejection{Reason: resolver.ReasonTimeout}), 30 * time.Second},
+		{"storage", errStorage, 0},
+		{"cancelled", context.Canceled, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := s.negativeTTL(tt.err); got != tt.want {
+				t.Fatalf("negativeTTL = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNegativeCacheReason checks that a cached miss reports the reason of
+// the original failure, and that storage failures are not cached at all.
+func TestNegativeCacheReason(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	s := &Server{Cache: cache.NewMemory(16, time.Hour)}
+
+	s.cacheMiss(ctx, "blocked.example", &resolver.Error{Reason: resolver.ReasonBlockedAddress, Err: resolver.ErrBlockedAddress})
+	err := s.cachedMiss(ctx, "blocked.example")
+	if !errors.Is(err, errNegativeCached) {
+		t.Fatalf("cachedMiss = %v, want a cached failure", err)
+	}
+	if p := lookupProblem("blocked.example", err); p.Reason != resolver.ReasonBlockedAddress || p.Status != http.StatusForbidden {
+		t.Fatalf("problem = %+v", p)
+	}
+
+	s.cacheMiss(ctx, "storage.example", errStorage)
+	if err := s.cachedMiss(ctx, "storage.example"); err != nil {
+		t.Fatalf("storage failure was cached: %v", err)
+	}
+
+	// Entries from before reasons were stored.
+	_ = s.Cache.Set(ctx, negativeKey("legacy.example"), "1")
+	if err := s.cachedMiss(ctx, "legacy.example"); !errors.Is(err, errIconNotFound) {
+		t.Fatalf("legacy entry: err = %v", err)
+	}
+}
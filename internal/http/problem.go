@@ -0,0 +1,139 @@
+package httpx
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kudanilll/favget/internal/resolver"
+)
+
+// Reasons for lookup failures that do not come from the resolver.
+const (
+	reasonNotFound resolver.Reason = "not_found"     // negative-cache entry without a stored reason
+	reasonStorage  resolver.Reason = "storage_error" // resolved, but the upload failed
+)
+
+// errStorage is returned by storeIcon and renderVariant when the object store
+// rejects the upload.
+var errStorage = errors.New("upload failed")
+
+// problemTypePrefix namespaces the problem "type" URIs; the suffix is the
+// reason, so clients can match on either field.
+const problemTypePrefix = "urn:favget:problem:"
+
+// problem is an RFC 9457 problem details object, extended with the lookup
+// reason and, when every candidate was rejected, why each one was.
+type problem struct {
+	Type       string             `json:"type"`
+	Title      string             `json:"title"`
+	Status     int                `json:"status"`
+	Detail     string             `json:"detail,omitempty"`
+	Domain     string             `json:"domain,omitempty"`
+	Reason     resolver.Reason    `json:"reason"`
+	Candidates []problemCandidate `json:"candidates,omitempty"`
+}
+
+type problemCandidate struct {
+	URL    string          `json:"url"`
+	Reason resolver.Reason `json:"reason,omitempty"`
+	Status int             `json:"status,omitempty"` // upstream HTTP status, when a response was received
+	Detail string          `json:"detail,omitempty"`
+}
+
+// displayURL returns u as echoed back to clients and recorded as an icon's
+// source_url. Inline data: icons can be megabytes long, so their payload is
+// replaced by its length, e.g. "data:image/png;base64,…(1234 bytes)".
+func displayURL(u string) string {
+	if len(u) < 5 || !strings.EqualFold(u[:5], "data:") {
+		return u
+	}
+	header, payload, ok := strings.Cut(u, ",")
+	if !ok {
+		return u
+	}
+	return header + ",…(" + strconv.Itoa(len(payload)) + " bytes)"
+}
+
+// problemTitles are the human-readable summaries for each reason.
+var problemTitles = map[resolver.Reason]string{
+	resolver.ReasonDNS:              "Domain does not resolve",
+	resolver.ReasonBlockedAddress:   "Domain resolves to a blocked address",
+	resolver.ReasonInsecureScheme:   "Plain HTTP not allowed",
+	resolver.ReasonTLS:              "TLS handshake failed",
+	resolver.ReasonTimeout:          "Upstream timed out",
+	resolver.ReasonTooManyRedirects: "Too many redirects",
+	resolver.ReasonUnreachable:      "Site unreachable",
+	resolver.ReasonHTMLTooLarge:     "No icon within the HTML size limit",
+	resolver.ReasonNoCandidates:     "Site declares no icons",
+	resolver.ReasonAllRejected:      "No usable icon",
+	reasonNotFound:                  "Icon not found",
+	reasonStorage:                   "Icon storage failed",
+}
+
+// problemStatus maps a lookup failure reason to an HTTP status. "Nothing to
+// serve" is 404, as before; policy refusals are 403 and upstream or storage
+// failures are 502/504, so they are not mistaken for a missing icon.
+func problemStatus(reason resolver.Reason) int {
+	switch reason {
+	case resolver.ReasonBlockedAddress, resolver.ReasonInsecureScheme:
+		return http.StatusForbidden
+	case resolver.ReasonTimeout:
+		return http.StatusGatewayTimeout
+	case resolver.ReasonTLS, resolver.ReasonUnreachable, resolver.ReasonTooManyRedirects, reasonStorage:
+		return http.StatusBadGateway
+	}
+	return http.StatusNotFound
+}
+
+// lookupProblem describes err, as returned by lookupIcon, for domain.
+func lookupProblem(domain string, err error) problem {
+	reason := reasonNotFound
+	var re *resolver.Error
+	switch {
+	case errors.As(err, &re):
+		reason = re.Reason
+	case errors.Is(err, errStorage):
+		reason = reasonStorage
+	case errors.Is(err, errIconNotFound):
+	default:
+		reason = resolver.ReasonOf(err)
+	}
+
+	p := problem{
+		Type:   problemTypePrefix + string(reason),
+		Title:  problemTitles[reason],
+		Status: problemStatus(reason),
+		Domain: domain,
+		Reason: reason,
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if re != nil {
+		if re.Err != nil {
+			p.Detail = re.Err.Error()
+		}
+		if errors.Is(re.Err, errNegativeCached) {
+			p.Title += " (cached)"
+		}
+		for _, c := range re.Rejected {
+			p.Candidates = append(p.Candidates, problemCandidate{URL: displayURL(c.URL), Reason: c.Reason, Status: c.Status, Detail: c.Detail})
+		}
+	} else if reason == reasonNotFound {
+		p.Detail = "a recent lookup for this domain failed; it is retried once the negative cache expires"
+	}
+	return p
+}
+
+// writeProblem sends p as application/problem+json. Failures are not cached
+// by clients; the negative cache already absorbs repeated lookups.
+func writeProblem(w http.ResponseWriter, p problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,116 @@
+package httpx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kudanilll/favget/internal/resolver"
+)
+
+func TestLookupProblem(t *testing.T) {
+	t.Parallel()
+
+	rejected := &resolver.Error{
+		Domain: "example.com",
+		Reason: resolver.ReasonAllRejected,
+		Rejected: []resolver.Rejection{
+			{URL: "https://example.com/icon.svg", Reason: resolver.ReasonUnsafeSVG, Detail: "imagex: SVG cannot be sanitized"},
+			{URL: "https://example.com/favicon.ico", Reason: resolver.ReasonHTTPStatus, Detail: "unexpected status"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantReason resolver.Reason
+		wantCands  int
+	}{
+		{"negative-cache", errIconNotFound, http.StatusNotFound, reasonNotFound, 0},
+		{"all-rejected", rejected, http.StatusNotFound, resolver.ReasonAllRejected, 2},
+		{"blocked", &resolver.Error{Domain: "example.com", Reason: resolver.ReasonBlockedAddress, Err: resolver.ErrBlockedAddress}, http.StatusForbidden, resolver.ReasonBlockedAddress, 0},
+		{"dns", &resolver.Error{Domain: "example.com", Reason: resolver.ReasonDNS}, http.StatusNotFound, resolver.ReasonDNS, 0},
+		{"tls", &resolver.Error{Domain: "example.com", Reason: resolver.ReasonTLS}, http.StatusBadGateway, resolver.ReasonTLS, 0},
+		{"storage", errStorage, http.StatusBadGateway, reasonStorage, 0},
+		{"raw-timeout", fmt.Errorf("singleflight: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, resolver.ReasonTimeout, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			w := httptest.NewRecorder()
+			writeProblem(w, lookupProblem("example.com", tt.err))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Fatalf("Content-Type = %q", ct)
+			}
+			var p problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if p.Reason != tt.wantReason || p.Type != problemTypePrefix+string(tt.wantReason) || p.Status != tt.wantStatus {
+				t.Fatalf("problem = %+v", p)
+			}
+			if p.Title == "" || p.Domain != "example.com" {
+				t.Fatalf("missing title/domain: %+v", p)
+			}
+			if len(p.Candidates) != tt.wantCands {
+				t.Fatalf("candidates = %+v, want %d", p.Candidates, tt.wantCands)
+			}
+		})
+	}
+}
+
+// TestLookupProblemCandidates checks what each rejected candidate carries:
+// the upstream status, and data: URIs shortened to their header and size.
+func TestLookupProblemCandidates(t *testing.T) {
+	t.Parallel()
+
+	inline := "data:image/png;base64," + strings.Repeat("A", 4096)
+	p := lookupProblem("example.com", &resolver.Error{
+		Domain: "example.com",
+		Reason: resolver.ReasonAllRejected,
+		Rejected: []resolver.Rejection{
+			{URL: "https://example.com/favicon.ico", Reason: resolver.ReasonHTTPStatus, Status: http.StatusForbidden},
+			{URL: inline, Reason: resolver.ReasonUndecodable},
+		},
+	})
+	want := []problemCandidate{
+		{URL: "https://example.com/favicon.ico", Reason: resolver.ReasonHTTPStatus, Status: http.StatusForbidden},
+		{URL: "data:image/png;base64,…(4096 bytes)", Reason: resolver.ReasonUndecodable},
+	}
+	if len(p.Candidates) != len(want) {
+		t.Fatalf("candidates = %+v, want %+v", p.Candidates, want)
+	}
+	for i := range want {
+		if p.Candidates[i] != want[i] {
+			t.Errorf("candidate %d = %+v, want %+v", i, p.Candidates[i], want[i])
+		}
+	}
+}
+
+func TestDisplayURL(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"https://example.com/icon.png":       "https://example.com/icon.png",
+		"data:image/svg+xml,%3Csvg%2F%3E":    "data:image/svg+xml,…(12 bytes)",
+		"DATA:image/png;base64,iVBORw0KGgo=": "DATA:image/png;base64,…(12 bytes)",
+		"data:image/png;base64":              "data:image/png;base64",
+		"data:,":                             "data:,…(0 bytes)",
+	}
+	for in, want := range tests {
+		if got := displayURL(in); got != want {
+			t.Errorf("displayURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package httpx
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"time"
+
+	"github.com/kudanilll/favget/internal/store"
+)
+
+// RefreshOptions configures the background revalidation worker.
+type RefreshOptions struct {
+	Interval time.Duration // pause between scans
+	MaxAge   time.Duration // revalidate icons not checked for this long
+	Batch    int           // icons claimed per scan
+}
+
+// RunRefresher periodically revalidates stored icons until ctx is done.
+// Each scan claims the icons checked least recently and re-resolves them;
+// an icon is re-uploaded only when its bytes actually changed.
+func (s *Server) RunRefresher(ctx context.Context, opt RefreshOptions) {
+	if opt.Batch <= 0 {
+		opt.Batch = 50
+	}
+	t := time.NewTicker(opt.Interval)
+	defer t.Stop()
+	for {
+		s.refreshStale(ctx, opt)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// refreshStale runs one scan. Errors are logged; the old icon keeps being
+// served and is retried once it is stale again.
+func (s *Server) refreshStale(ctx context.Context, opt RefreshOptions) {
+	recs, err := s.DB.ClaimStale(ctx, time.Now().Add(-opt.MaxAge), opt.Batch)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("refresh: claim failed: %v", err)
+		}
+		return
+	}
+	updated := 0
+	for i := range recs {
+		if ctx.Err() != nil {
+			return
+		}
+		_, changed, err := s.refreshIcon(ctx, &recs[i])
+		if err != nil {
+			log.Printf("refresh: %s: %v", recs[i].Domain, err)
+			continue
+		}
+		if changed {
+			updated++
+		}
+	}
+	if len(recs) > 0 {
+		log.Printf("refresh: checked %d icons, %d changed", len(recs), updated)
+	}
+}
+
+// refreshIcon revalidates one stored icon, returning the entry to serve from
+// now on and whether it was re-uploaded. The stored ETag is sent as
+// If-None-Match; without a 304 the new bytes are compared with the stored
+// content before anything is written.
+func (s *Server) refreshIcon(ctx context.Context, rec *store.IconRecord) (iconEntry, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	prevETag := ""
+	if rec.ETag != nil {
+		prevETag = *rec.ETag
+	}
+	old := entryFromRecord(rec)
+	src, meta, notModified, err := s.Resolver.Revalidate(ctx, rec.Domain, rec.SourceURL, prevETag)
+	if err != nil {
+		return old, false, err
+	}
+	if notModified {
+		return old, false, nil
+	}
+
+	// Blob keys do not depend on the source URL, so an icon that moved to a
+	// new URL with the same bytes only needs its row updated; legacy objects
+	// are keyed by the source URL and are re-stored under a blob instead.
+	// Inline data: sources are recorded abbreviated, like storeIcon does.
+	stored := src
+	if rec.ContentHash != nil {
+		stored = displayURL(src)
+	}
+	if stored == rec.SourceURL || rec.ContentHash != nil {
+		data, _, _ := s.storableIcon(meta)
+		if s.sameContent(ctx, rec, old.Key, data) {
+			if stored != rec.SourceURL || (meta.ETag != nil && *meta.ETag != prevETag) {
+				_ = s.DB.SetSource(ctx, rec.Domain, stored, meta.ETag)
+			}
+			return old, false, nil
+		}
+	}
+
+	e, err := s.storeIcon(ctx, rec.Domain, src, meta)
+	if err != nil {
+		return old, false, err
+	}
+	if rec.ContentHash == nil && old.Key != e.Key {
+		// The icon moved off its legacy per-domain object; drop it. Blobs
+		// are shared and only go away once unreferenced (see sweepBlobs).
+		if err := s.Store.Delete(ctx, old.Key); err != nil {
+			log.Printf("refresh: delete %s: %v", old.Key, err)
+		}
+	}
+	return e, true, nil
+}
+
+// sameContent reports whether data is the content rec already stores,
+// comparing hashes when the row has one and the stored bytes otherwise.
+func (s *Server) sameContent(ctx context.Context, rec *store.IconRecord, key string, data []byte) bool {
+	if rec.ContentHash != nil {
+		return *rec.ContentHash == contentHash(data)
+	}
+	return s.storedBytesEqual(ctx, key, data)
+}
+
+// storedBytesEqual reports whether the object at key holds exactly data.
+func (s *Server) storedBytesEqual(ctx context.Context, key string, data []byte) bool {
+	body, info, err := s.Store.Get(ctx, key)
+	if err != nil {
+		return false
+	}
+	defer body.Close()
+	if info.Size >= 0 && info.Size != int64(len(data)) {
+		return false
+	}
+	cur, err := io.ReadAll(io.LimitReader(body, int64(len(data))+1))
+	return err == nil && bytes.Equal(cur, data)
+}
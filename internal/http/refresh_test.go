@@ -0,0 +1,351 @@
+package httpx
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kudanilll/favget/internal/cache"
+	"github.com/kudanilll/favget/internal/resolver"
+	"github.com/kudanilll/favget/internal/storage"
+	"github.com/kudanilll/favget/internal/store"
+)
+
+// fakeDB records the writes refreshIcon makes. Methods it does not
+// implement panic through the nil embedded IconStore.
+type fakeDB struct {
+	IconStore
+
+	mu      sync.Mutex
+	stale   []store.IconRecord // returned by ClaimStale
+	claimed int                // rows ClaimStale marked checked
+	blobs   map[string]*store.Blob
+	upserts []store.IconRecord
+	sources []string // source URLs passed to SetSource
+	etags   []string // ETags passed to SetSource
+
+	renditions map[string][]string // AddBlobRendition keys by blob hash
+}
+
+func (f *fakeDB) ClaimStale(ctx context.Context, before time.Time, limit int) ([]store.IconRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	recs := f.stale
+	f.stale = nil
+	for i := range recs {
+		recs[i].CheckedAt = time.Now()
+	}
+	f.claimed += len(recs)
+	return recs, nil
+}
+
+func (f *fakeDB) ClaimBlob(ctx context.Context, b store.Blob) (*store.Blob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.blobs == nil {
+		f.blobs = map[string]*store.Blob{}
+	}
+	if cur, ok := f.blobs[b.Hash]; ok {
+		out := *cur
+		return &out, nil
+	}
+	f.blobs[b.Hash] = &b
+	out := b
+	return &out, nil
+}
+
+func (f *fakeDB) SetBlobLocation(ctx context.Context, hash, key, url string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.blobs[hash].StorageKey, f.blobs[hash].StorageURL = key, url
+	return nil
+}
+
+func (f *fakeDB) Upsert(ctx context.Context, rec store.IconRecord) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.upserts = append(f.upserts, rec)
+	return time.Now().Truncate(time.Microsecond), nil
+}
+
+func (f *fakeDB) SetSource(ctx context.Context, domain, sourceURL string, etag *string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sources = append(f.sources, sourceURL)
+	if etag != nil {
+		f.etags = append(f.etags, *etag)
+	}
+	return nil
+}
+
+func (f *fakeDB) AddBlobRendition(ctx context.Context, hash, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.renditions == nil {
+		f.renditions = map[string][]string{}
+	}
+	f.renditions[hash] = append(f.renditions[hash], key)
+	return nil
+}
+
+func (f *fakeDB) AddVersion(ctx context.Context, v store.IconVersion) (*store.IconVersion, error) {
+	return &v, nil
+}
+
+// fakeResolver answers Revalidate with a fixed result.
+type fakeResolver struct {
+	IconResolver
+
+	src         string
+	meta        resolver.Meta
+	notModified bool
+}
+
+func (f *fakeResolver) Revalidate(ctx context.Context, target, prevSrc, prevETag string) (string, resolver.Meta, bool, error) {
+	return f.src, f.meta, f.notModified, nil
+}
+
+// recordingStore records the keys written to and deleted from an
+// ObjectStore.
+type recordingStore struct {
+	storage.ObjectStore
+
+	mu                      sync.Mutex
+	puts, deletes, prefixes []string
+}
+
+func (r *recordingStore) Put(ctx context.Context, key string, data []byte, contentType string) (string, error) {
+	r.mu.Lock()
+	r.puts = append(r.puts, key)
+	r.mu.Unlock()
+	return r.ObjectStore.Put(ctx, key, data, contentType)
+}
+
+func (r *recordingStore) Delete(ctx context.Context, key string) error {
+	r.mu.Lock()
+	r.deletes = append(r.deletes, key)
+	r.mu.Unlock()
+	return r.ObjectStore.Delete(ctx, key)
+}
+
+func (r *recordingStore) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	r.mu.Lock()
+	r.prefixes = append(r.prefixes, prefix)
+	r.mu.Unlock()
+	return r.ObjectStore.DeletePrefix(ctx, prefix)
+}
+
+func solidPNG(t *testing.T, c color.Color) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for i := 0; i < 16; i++ {
+		img.Set(i%4, i/4, c)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestRefreshIcon covers the outcomes of revalidating a stored icon: only
+// changed bytes are uploaded, and only then do updated_at and the served
+// validators move. checked_at is bumped by the claim before refreshIcon runs.
+func TestRefreshIcon(t *testing.T) {
+	t.Parallel()
+
+	const (
+		domain = "a.example"
+		oldSrc = "https://a.example/icon.png"
+		newSrc = "https://a.example/moved.png"
+	)
+	oldPNG := solidPNG(t, color.NRGBA{R: 0xff, A: 0xff})
+	newPNG := solidPNG(t, color.NRGBA{B: 0xff, A: 0xff})
+	dataSrc := "data:image/png;base64," + base64.StdEncoding.EncodeToString(oldPNG)
+	oldHash, newHash := contentHash(oldPNG), contentHash(newPNG)
+	updated := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ptr := func(s string) *string { return &s }
+	meta := func(src string, data []byte, etag string) resolver.Meta {
+		return resolver.Meta{SourceURL: src, Data: data, Format: "png", ContentType: ptr("image/png"), ETag: ptr(etag)}
+	}
+
+	tests := []struct {
+		name        string
+		legacy      bool // row stored before blobs: no content hash, per-domain object
+		src         string
+		meta        resolver.Meta
+		notModified bool
+		storedSrc   string // source_url of the row; "" = oldSrc
+		wantChanged bool
+		wantSource  string // source URL recorded without a re-store; "" = none
+		wantPut     string // object uploaded; "" = none
+		wantDeleted string // object deleted; "" = none
+	}{
+		{
+			name:        "not-modified",
+			src:         oldSrc,
+			notModified: true,
+		},
+		{
+			name:       "moved-same-bytes",
+			src:        newSrc,
+			meta:       meta(newSrc, oldPNG, `"v2"`),
+			wantSource: newSrc,
+		},
+		{
+			name:       "same-bytes-new-etag",
+			src:        oldSrc,
+			meta:       meta(oldSrc, oldPNG, `"v2"`),
+			wantSource: oldSrc,
+		},
+		{
+			name:       "moved-inline",
+			src:        dataSrc,
+			meta:       meta(dataSrc, oldPNG, `"v2"`),
+			wantSource: displayURL(dataSrc),
+		},
+		{
+			name:      "inline-same-bytes",
+			storedSrc: displayURL(dataSrc),
+			src:       dataSrc,
+			meta:      resolver.Meta{SourceURL: dataSrc, Data: oldPNG, Format: "png", ContentType: ptr("image/png")},
+		},
+		{
+			name:        "changed-bytes",
+			src:         oldSrc,
+			meta:        meta(oldSrc, newPNG, `"v2"`),
+			wantChanged: true,
+			wantPut:     storage.BlobKey(newHash),
+		},
+		{
+			name:        "changed-bytes-legacy",
+			legacy:      true,
+			src:         oldSrc,
+			meta:        meta(oldSrc, newPNG, `"v2"`),
+			wantChanged: true,
+			wantPut:     storage.BlobKey(newHash),
+			wantDeleted: storage.ObjectKey(domain, oldSrc),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			local, err := storage.NewLocal(t.TempDir(), "/objects")
+			if err != nil {
+				t.Fatalf("NewLocal: %v", err)
+			}
+			objects := &recordingStore{ObjectStore: local}
+			storedSrc := tt.storedSrc
+			if storedSrc == "" {
+				storedSrc = oldSrc
+			}
+			rec := &store.IconRecord{
+				Domain:      domain,
+				SourceURL:   storedSrc,
+				ETag:        ptr(`"v1"`),
+				ContentType: ptr("image/png"),
+				UpdatedAt:   updated,
+				CheckedAt:   time.Now(),
+			}
+			oldKey := storage.ObjectKey(domain, oldSrc)
+			if !tt.legacy {
+				rec.ContentHash = ptr(oldHash)
+				oldKey = storage.BlobKey(oldHash)
+			}
+			if rec.IconURL, err = local.Put(context.Background(), oldKey, oldPNG, "image/png"); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+
+			db := &fakeDB{}
+			s := &Server{
+				DB:       db,
+				Store:    objects,
+				Cache:    cache.New(cache.Options{}),
+				Resolver: &fakeResolver{src: tt.src, meta: tt.meta, notModified: tt.notModified},
+			}
+			old := entryFromRecord(rec)
+			e, changed, err := s.refreshIcon(context.Background(), rec)
+			if err != nil {
+				t.Fatalf("refreshIcon: %v", err)
+			}
+			if changed != tt.wantChanged {
+				t.Fatalf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+
+			if !tt.wantChanged {
+				// Nothing re-stored: the entry, its updated_at and the
+				// validators clients hold all stay as they were.
+				if e != old || e.etag() != old.etag() || !e.UpdatedAt.Equal(updated) {
+					t.Errorf("entry = %+v, want the stored %+v", e, old)
+				}
+				if len(db.upserts) != 0 || len(objects.puts) != 0 || len(objects.deletes) != 0 {
+					t.Errorf("writes: %d upserts, puts %v, deletes %v; want none", len(db.upserts), objects.puts, objects.deletes)
+				}
+				switch {
+				case tt.wantSource == "" && len(db.sources) != 0:
+					t.Errorf("SetSource(%v), want no call", db.sources)
+				case tt.wantSource != "" && (len(db.sources) != 1 || db.sources[0] != tt.wantSource || db.etags[0] != `"v2"`):
+					t.Errorf("SetSource(%v, %v), want %s with the new ETag", db.sources, db.etags, tt.wantSource)
+				}
+				return
+			}
+
+			if len(objects.puts) != 1 || objects.puts[0] != tt.wantPut {
+				t.Errorf("puts = %v, want [%s]", objects.puts, tt.wantPut)
+			}
+			if len(db.upserts) != 1 || db.upserts[0].ContentHash == nil || *db.upserts[0].ContentHash != newHash {
+				t.Errorf("upserts = %+v, want one for the new content", db.upserts)
+			}
+			if e.Key != tt.wantPut || e.UpdatedAt.Equal(updated) || e.etag() == old.etag() {
+				t.Errorf("entry = %+v, want the new blob with a new updated_at", e)
+			}
+			if tt.wantDeleted == "" {
+				if len(objects.deletes) != 0 {
+					t.Errorf("deletes = %v; shared blobs are left to the sweeper", objects.deletes)
+				}
+				return
+			}
+			if len(objects.deletes) != 1 || objects.deletes[0] != tt.wantDeleted {
+				t.Errorf("deletes = %v, want [%s]", objects.deletes, tt.wantDeleted)
+			}
+			if _, _, err := local.Get(context.Background(), tt.wantDeleted); err != storage.ErrNotFound {
+				t.Errorf("old object still readable: %v", err)
+			}
+		})
+	}
+}
+
+// TestRefreshStaleNotModified checks that a scan whose icons all answer 304
+// writes nothing but the claim, which is what moves checked_at.
+func TestRefreshStaleNotModified(t *testing.T) {
+	t.Parallel()
+
+	local, err := storage.NewLocal(t.TempDir(), "/objects")
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	objects := &recordingStore{ObjectStore: local}
+	hash := "0000000000000000000000000000000000000000000000000000000000000000"
+	db := &fakeDB{stale: []store.IconRecord{
+		{Domain: "a.example", SourceURL: "https://a.example/icon.png", ContentHash: &hash},
+		{Domain: "b.example", SourceURL: "https://b.example/icon.png", ContentHash: &hash},
+	}}
+	s := &Server{DB: db, Store: objects, Cache: cache.New(cache.Options{}), Resolver: &fakeResolver{notModified: true}}
+
+	s.refreshStale(context.Background(), RefreshOptions{MaxAge: time.Hour, Batch: 10})
+	if db.claimed != 2 {
+		t.Fatalf("claimed %d rows, want 2", db.claimed)
+	}
+	if len(db.upserts) != 0 || len(db.sources) != 0 || len(objects.puts) != 0 || len(objects.deletes) != 0 {
+		t.Fatalf("writes after 304s: %d upserts, %d source updates, puts %v, deletes %v",
+			len(db.upserts), len(db.sources), objects.puts, objects.deletes)
+	}
+}
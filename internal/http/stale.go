@@ -0,0 +1,110 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Age of a stored icon relative to the soft and hard TTLs.
+type freshness int
+
+const (
+	fresh   freshness = iota // serve as-is
+	stale                    // serve, and re-resolve in the background
+	expired                  // re-resolve before serving
+)
+
+// staleRefreshTimeout bounds one background re-resolve.
+const staleRefreshTimeout = 20 * time.Second
+
+// freshness classifies e by the time since it was last resolved or
+// revalidated. Entries without that time (written by older versions) are
+// treated as fresh; they are replaced when the cache entry expires.
+func (s *Server) freshness(e iconEntry, now time.Time) freshness {
+	checked := e.CheckedAt
+	if checked.IsZero() {
+		checked = e.UpdatedAt
+	}
+	if checked.IsZero() {
+		return fresh
+	}
+	age := now.Sub(checked)
+	switch {
+	case s.HardTTLSec > 0 && age >= time.Duration(s.HardTTLSec)*time.Second:
+		return expired
+	case s.SoftTTLSec > 0 && age >= time.Duration(s.SoftTTLSec)*time.Second:
+		return stale
+	}
+	return fresh
+}
+
+// usableEntry reports whether e can be served without waiting for a
+// resolve, starting a background revalidation if it is past the soft TTL.
+func (s *Server) usableEntry(domain string, e iconEntry) bool {
+	switch s.freshness(e, time.Now()) {
+	case stale:
+		s.revalidateAsync(domain)
+	case expired:
+		return false
+	}
+	return true
+}
+
+// revalidateAsync re-resolves domain in the background through the
+// singleflight group, under the same key as blocking resolves: a stream of
+// requests for a stale icon starts only one revalidation per process, and a
+// request that has to wait for the domain joins it rather than resolving
+// alongside it.
+func (s *Server) revalidateAsync(domain string) {
+	revalidate := s.revalidate
+	if revalidate == nil {
+		if s.DB == nil {
+			return
+		}
+		revalidate = s.revalidateStored
+	}
+	// DoChan returns immediately; the buffered result channel is dropped.
+	s.singleflight.DoChan("icon:"+domain, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), staleRefreshTimeout)
+		defer cancel()
+
+		e, err := revalidate(ctx, domain)
+		if err != nil {
+			log.Printf("revalidate %s: %v", domain, err)
+			return nil, err
+		}
+		return e, nil
+	})
+}
+
+// revalidateStored revalidates domain's stored icon and returns the entry to
+// serve. The row is claimed in the DB first (which also bumps checked_at),
+// so replicas do not repeat each other's work; the fresh check time is
+// written back to the cache so requests stop enqueuing.
+func (s *Server) revalidateStored(ctx context.Context, domain string) (iconEntry, error) {
+	soft := time.Duration(s.SoftTTLSec) * time.Second
+	rec, err := s.DB.ClaimIfStale(ctx, domain, time.Now().Add(-soft))
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Already revalidated (or being revalidated) elsewhere: pick up
+		// the newer check time instead.
+		rec, err := s.DB.FindByDomain(ctx, domain)
+		if err != nil {
+			return iconEntry{}, err
+		}
+		e := entryFromRecord(rec)
+		_ = s.Cache.Set(ctx, "icon:"+domain, e.encode())
+		return e, nil
+	}
+	if err != nil {
+		return iconEntry{}, fmt.Errorf("claim failed: %w", err)
+	}
+	_ = s.Cache.Set(ctx, "icon:"+domain, entryFromRecord(rec).encode())
+
+	e, _, err := s.refreshIcon(ctx, rec)
+	return e, err
+}
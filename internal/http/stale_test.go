@@ -0,0 +1,85 @@
+package httpx
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kudanilll/favget/internal/cache"
+)
+
+func TestFreshness(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1_700_000_000, 0)
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+
+	tests := []struct {
+		name       string
+		soft, hard int
+		e          iconEntry
+		want       freshness
+	}{
+		{"fresh", 3600, 0, iconEntry{CheckedAt: ago(time.Minute)}, fresh},
+		{"soft-expired", 3600, 0, iconEntry{CheckedAt: ago(2 * time.Hour)}, stale},
+		{"hard-expired", 3600, 7200, iconEntry{CheckedAt: ago(3 * time.Hour)}, expired},
+		{"between-ttls", 3600, 7200, iconEntry{CheckedAt: ago(90 * time.Minute)}, stale},
+		{"checked-recently", 3600, 7200, iconEntry{UpdatedAt: ago(30 * 24 * time.Hour), CheckedAt: ago(time.Minute)}, fresh},
+		{"no-check-time", 3600, 0, iconEntry{UpdatedAt: ago(2 * time.Hour)}, stale},
+		{"legacy-entry", 3600, 7200, iconEntry{}, fresh},
+		{"disabled", 0, 0, iconEntry{CheckedAt: ago(365 * 24 * time.Hour)}, fresh},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s := &Server{SoftTTLSec: tt.soft, HardTTLSec: tt.hard}
+			if got := s.freshness(tt.e, now); got != tt.want {
+				t.Fatalf("freshness = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestStaleHitRevalidatesOnce checks that stale hits are served the old entry
+// without waiting, that they start a single revalidation between them, and
+// that a blocking resolve for the same domain joins it.
+func TestStaleHitRevalidatesOnce(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	updated := iconEntry{URL: "https://cdn.example/new.png", Key: "new", CheckedAt: time.Now()}
+	s := &Server{
+		Cache:      cache.New(cache.Options{}),
+		SoftTTLSec: 60,
+		revalidate: func(ctx context.Context, domain string) (iconEntry, error) {
+			calls.Add(1)
+			<-release
+			return updated, nil
+		},
+	}
+	ctx := context.Background()
+	old := iconEntry{URL: "https://cdn.example/old.png", Key: "old", CheckedAt: time.Now().Add(-2 * time.Minute)}
+	_ = s.Cache.Set(ctx, "icon:a.example", old.encode())
+
+	for i := 0; i < 5; i++ {
+		e, err := s.lookupIcon(ctx, "a.example", false)
+		if err != nil || e.URL != old.URL {
+			t.Fatalf("lookup %d = %+v, %v; want the stale entry", i, e, err)
+		}
+	}
+
+	// The blocking resolve registers with the singleflight group before it
+	// waits, so releasing the revalidation afterwards lets it join.
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	wctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	e, err := s.resolveAndUpload("a.example", wctx)
+	if err != nil || e.URL != updated.URL {
+		t.Fatalf("joined resolve = %+v, %v; want the revalidated entry", e, err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("revalidations = %d, want 1", n)
+	}
+}
@@ -0,0 +1,140 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	imagex "github.com/kudanilll/favget/internal/image"
+	"github.com/kudanilll/favget/internal/storage"
+)
+
+// variant describes a derived rendition requested via size= and format=.
+// The zero value means "the stored original".
+type variant struct {
+	Size   int // 0 keeps the native size
+	Format imagex.Format
+}
+
+// suffix identifies the rendition in cache and storage keys, e.g. "64_png".
+func (v variant) suffix() string {
+	return strconv.Itoa(v.Size) + "_" + string(v.Format)
+}
+
+// parseVariant reads size= (16–512) and format= (png|webp|ico|svg). A size
+// without a format renders PNG; a format without a size keeps the native size.
+func parseVariant(r *http.Request) (variant, error) {
+	q := r.URL.Query()
+	var v variant
+	if s := q.Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < imagex.MinRenderSize || n > imagex.MaxRenderSize {
+			return variant{}, fmt.Errorf("invalid size: must be %d-%d", imagex.MinRenderSize, imagex.MaxRenderSize)
+		}
+		v.Size = n
+	}
+	switch f := imagex.Format(strings.ToLower(q.Get("format"))); f {
+	case "":
+		if v.Size > 0 {
+			v.Format = imagex.FormatPNG
+		}
+	case imagex.FormatPNG, imagex.FormatWebP, imagex.FormatICO, imagex.FormatSVG:
+		v.Format = f
+	default:
+		return variant{}, errors.New("invalid format: must be png, webp, ico or svg")
+	}
+	if v.Format == imagex.FormatICO && v.Size > imagex.MaxICOSize {
+		return variant{}, fmt.Errorf("invalid size: ico output is limited to %d", imagex.MaxICOSize)
+	}
+	return v, nil
+}
+
+// handleVariant serves a derived rendition of the domain's stored icon.
+// Renditions are stored next to the original and cached under
+// icon:<domain>@<size>_<format>; they are regenerated whenever the original
+// is re-stored.
+func (s *Server) handleVariant(ctx context.Context, w http.ResponseWriter, r *http.Request, domain string, v variant, mode, fallback string) {
+	base, err := s.lookupIcon(ctx, domain, true)
+	if err != nil {
+		s.iconNotFound(w, r, domain, v, fallback, err)
+		return
+	}
+
+	cacheKey := "icon:" + domain + "@" + v.suffix()
+	if c, err := s.Cache.Get(ctx, cacheKey); err == nil {
+		if e, ok := decodeIconEntry(c); ok && e.Key != "" && e.UpdatedAt.Equal(base.UpdatedAt) {
+			s.respondIcon(ctx, w, r, e, mode)
+			return
+		}
+	}
+
+	e, err := s.renderVariant(ctx, domain, base, v)
+	if err != nil {
+		http.Error(w, "rendition unavailable", http.StatusBadGateway)
+		return
+	}
+	s.respondIcon(ctx, w, r, e, mode)
+}
+
+// renderVariant derives rendition v from the stored original, stores it and
+// caches its entry. Concurrent requests for the same rendition share one render.
+// It stops waiting when ctx is done; the render carries on for other waiters.
+func (s *Server) renderVariant(ctx context.Context, domain string, base iconEntry, v variant) (iconEntry, error) {
+	ch := s.singleflight.DoChan("variant:"+domain+"@"+v.suffix(), func() (interface{}, error) {
+		bgCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 15*time.Second)
+		defer cancel()
+
+		body, _, err := s.Store.Get(bgCtx, base.Key)
+		if err != nil {
+			log.Printf("variant source read failed for %s: %v", domain, err)
+			return nil, err
+		}
+		src, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := imagex.Render(src, v.Size, v.Format)
+		if err != nil {
+			log.Printf("render %s failed for %s: %v", v.suffix(), domain, err)
+			return nil, err
+		}
+
+		// Renditions of a blob are recorded before the upload, so the sweeper
+		// deletes them by key rather than listing the blob's prefix.
+		key := base.Key + "_" + v.suffix()
+		if hash, ok := storage.BlobHash(base.Key); ok && s.DB != nil {
+			if err := s.DB.AddBlobRendition(bgCtx, hash, key); err != nil {
+				log.Printf("rendition record failed for %s: %v", key, err)
+			}
+		}
+		ct := v.Format.MIME()
+		u, err := s.Store.Put(bgCtx, key, data, ct)
+		if err != nil {
+			log.Printf("variant upload failed for %s: %v", domain, err)
+			return nil, errStorage
+		}
+
+		// UpdatedAt follows the original so a re-stored icon invalidates its renditions.
+		e := iconEntry{URL: u, Key: key, ContentType: ct, UpdatedAt: base.UpdatedAt}
+		_ = s.Cache.Set(bgCtx, "icon:"+domain+"@"+v.suffix(), e.encode())
+		return e, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return iconEntry{}, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return iconEntry{}, res.Err
+		}
+		return res.Val.(iconEntry), nil
+	}
+}
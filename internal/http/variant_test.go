@@ -0,0 +1,126 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kudanilll/favget/internal/cache"
+	imagex "github.com/kudanilll/favget/internal/image"
+	"github.com/kudanilll/favget/internal/storage"
+)
+
+func TestParseVariant(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		query   string
+		want    variant
+		wantErr bool
+	}{
+		{"", variant{}, false},
+		{"size=64", variant{64, imagex.FormatPNG}, false},
+		{"format=webp", variant{0, imagex.FormatWebP}, false},
+		{"size=32&format=ICO", variant{32, imagex.FormatICO}, false},
+		{"size=512&format=svg", variant{512, imagex.FormatSVG}, false},
+		{"size=8", variant{}, true},
+		{"size=1024", variant{}, true},
+		{"size=abc", variant{}, true},
+		{"format=jpeg", variant{}, true},
+		{"size=300&format=ico", variant{}, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.query, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, "/v1/icon?domain=example.com&"+tt.query, nil)
+			got, err := parseVariant(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseVariant error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("parseVariant = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRenderVariantStopsWaiting checks that a client whose request ends
+// stops waiting for a render another request started.
+func TestRenderVariantStopsWaiting(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{}
+	v := variant{Size: 32, Format: imagex.FormatPNG}
+	release := make(chan struct{})
+	defer close(release)
+	s.singleflight.DoChan("variant:slow.example@"+v.suffix(), func() (interface{}, error) {
+		<-release
+		return iconEntry{}, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := s.renderVariant(ctx, "slow.example", iconEntry{Key: "k"}, v)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("returned after %v, want right after the deadline", d)
+	}
+}
+
+// TestRenderVariantRecordsRendition checks that renditions of a blob are
+// recorded on it for the sweeper, and that legacy objects record nothing.
+func TestRenderVariantRecordsRendition(t *testing.T) {
+	t.Parallel()
+
+	png := solidPNG(t, color.NRGBA{G: 0xff, A: 0xff})
+	hash := contentHash(png)
+	v := variant{Size: 32, Format: imagex.FormatPNG}
+	tests := []struct {
+		name string
+		key  string
+		want []string
+	}{
+		{"blob", storage.BlobKey(hash), []string{storage.BlobKey(hash) + "_" + v.suffix()}},
+		{"legacy", storage.ObjectKey("a.example", "https://a.example/icon.png"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			local, err := storage.NewLocal(t.TempDir(), "/objects")
+			if err != nil {
+				t.Fatalf("NewLocal: %v", err)
+			}
+			ctx := context.Background()
+			if _, err := local.Put(ctx, tt.key, png, "image/png"); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			db := &fakeDB{}
+			s := &Server{DB: db, Store: local, Cache: cache.New(cache.Options{})}
+
+			e, err := s.renderVariant(ctx, "a.example", iconEntry{Key: tt.key}, v)
+			if err != nil {
+				t.Fatalf("renderVariant: %v", err)
+			}
+			if got := db.renditions[hash]; !slices.Equal(got, tt.want) {
+				t.Fatalf("recorded renditions = %v, want %v", got, tt.want)
+			}
+			body, _, err := local.Get(ctx, e.Key)
+			if err != nil {
+				t.Fatalf("rendition %s not stored: %v", e.Key, err)
+			}
+			body.Close()
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package imagex
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Avatar is a deterministic placeholder for a domain without an icon: its
+// first letter on a background colour derived from the domain's hash.
+type Avatar struct {
+	Letter string
+	Color  color.NRGBA
+}
+
+// LetterAvatar returns the placeholder for domain. The same domain always
+// yields the same letter and colour. Only ASCII letters and digits are used
+// so the embedded font always has the glyph; anything else becomes "?".
+func LetterAvatar(domain string) Avatar {
+	letter := "?"
+	for _, r := range strings.TrimPrefix(domain, "xn--") {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			letter = strings.ToUpper(string(r))
+			break
+		}
+	}
+	sum := sha1.Sum([]byte(domain))
+	hue := float64(int(sum[0])<<8|int(sum[1])) / 65536 * 360
+	return Avatar{Letter: letter, Color: hslToRGB(hue, 0.55, 0.45)}
+}
+
+// SVG renders the avatar as a size×size SVG document.
+func (a Avatar) SVG(size int) []byte {
+	return []byte(fmt.Sprintf(
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 100 100">`+
+			`<rect width="100" height="100" rx="20" fill="#%02x%02x%02x"/>`+
+			`<text x="50" y="50" dy=".35em" text-anchor="middle" fill="#fff" `+
+			`font-family="system-ui,-apple-system,Segoe UI,Roboto,Helvetica,Arial,sans-serif" font-size="56" font-weight="700">%s</text></svg>`,
+		size, size, a.Color.R, a.Color.G, a.Color.B, a.Letter))
+}
+
+// Image rasterizes the avatar at size×size, for PNG, WebP and ICO output.
+func (a Avatar) Image(size int) (image.Image, error) {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	drawRoundedRect(img, a.Color, float64(size)*0.2)
+
+	face, err := avatarFace(float64(size) * 0.56)
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	d := font.Drawer{Dst: img, Src: image.NewUniform(color.White), Face: face}
+	b, adv := d.BoundString(a.Letter)
+	// Centre the glyph's ink box, not its advance box, so letters sit optically centred.
+	w := (b.Max.X - b.Min.X).Ceil()
+	h := (b.Max.Y - b.Min.Y).Ceil()
+	if w <= 0 {
+		w = adv.Ceil()
+	}
+	d.Dot = fixed.Point26_6{
+		X: fixed.I((size-w)/2) - b.Min.X,
+		Y: fixed.I((size-h)/2) - b.Min.Y,
+	}
+	d.DrawString(a.Letter)
+	return img, nil
+}
+
+var (
+	avatarFontOnce sync.Once
+	avatarFont     *opentype.Font
+	avatarFontErr  error
+)
+
+// avatarFace returns a Go Bold face at the given pixel size.
+func avatarFace(px float64) (font.Face, error) {
+	avatarFontOnce.Do(func() {
+		avatarFont, avatarFontErr = opentype.Parse(gobold.TTF)
+	})
+	if avatarFontErr != nil {
+		return nil, avatarFontErr
+	}
+	return opentype.NewFace(avatarFont, &opentype.FaceOptions{Size: px, DPI: 72, Hinting: font.HintingFull})
+}
+
+// drawRoundedRect fills img with c, leaving anti-aliased rounded corners of
+// radius r transparent.
+func drawRoundedRect(img *image.NRGBA, c color.NRGBA, r float64) {
+	b := img.Bounds()
+	w, h := float64(b.Dx()), float64(b.Dy())
+	draw.Draw(img, b, image.NewUniform(c), image.Point{}, draw.Src)
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			// Distance from the pixel centre to the nearest corner circle's centre.
+			cx := math.Max(r-(float64(x)+0.5), (float64(x)+0.5)-(w-r))
+			cy := math.Max(r-(float64(y)+0.5), (float64(y)+0.5)-(h-r))
+			if cx <= 0 || cy <= 0 {
+				continue
+			}
+			cov := r + 0.5 - math.Hypot(cx, cy)
+			if cov >= 1 {
+				continue
+			}
+			px := c
+			px.A = uint8(float64(c.A) * math.Max(0, cov))
+			img.SetNRGBA(x, y, px)
+		}
+	}
+}
+
+// hslToRGB converts hue (degrees), saturation and lightness (0–1) to sRGB.
+func hslToRGB(h, s, l float64) color.NRGBA {
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	return color.NRGBA{
+		R: uint8(math.Round((r + m) * 255)),
+		G: uint8(math.Round((g + m) * 255)),
+		B: uint8(math.Round((b + m) * 255)),
+		A: 255,
+	}
+}
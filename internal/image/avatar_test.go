@@ -0,0 +1,66 @@
+package imagex_test
+
+import (
+	"testing"
+
+	imagex "github.com/kudanilll/favget/internal/image"
+)
+
+func TestLetterAvatar(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		domain     string
+		wantLetter string
+	}{
+		{"github.com", "G"},
+		{"9gag.com", "9"},
+		{"xn--bcher-kva.example", "B"},
+		{"-.example", "E"},
+		{"例え.jp", "J"},
+	}
+	for _, tt := range tests {
+		if got := imagex.LetterAvatar(tt.domain); got.Letter != tt.wantLetter {
+			t.Errorf("LetterAvatar(%q).Letter = %q, want %q", tt.domain, got.Letter, tt.wantLetter)
+		}
+	}
+
+	if imagex.LetterAvatar("github.com") != imagex.LetterAvatar("github.com") {
+		t.Fatalf("avatar is not deterministic")
+	}
+	if imagex.LetterAvatar("github.com").Color == imagex.LetterAvatar("gitlab.com").Color {
+		t.Fatalf("different domains share a colour")
+	}
+}
+
+// TestAvatarOutputs checks the SVG and raster renderings decode at the
+// requested size.
+func TestAvatarOutputs(t *testing.T) {
+	t.Parallel()
+
+	a := imagex.LetterAvatar("example.com")
+
+	info, err := imagex.Decode(a.SVG(48))
+	if err != nil || info.Format != imagex.FormatSVG || info.Width != 48 {
+		t.Fatalf("Decode(SVG) = %+v, %v; want 48px svg", info, err)
+	}
+
+	img, err := a.Image(96)
+	if err != nil {
+		t.Fatalf("Image error: %v", err)
+	}
+	data, err := imagex.Encode(img, imagex.FormatPNG)
+	if err != nil {
+		t.Fatalf("Encode error: %v", err)
+	}
+	if info, err := imagex.Decode(data); err != nil || info.Width != 96 || info.Height != 96 {
+		t.Fatalf("Decode(PNG) = %+v, %v; want 96x96", info, err)
+	}
+	// Corners are transparent, the centre of the left edge is the background colour.
+	if _, _, _, alpha := img.At(0, 0).RGBA(); alpha != 0 {
+		t.Fatalf("corner alpha = %d, want 0", alpha)
+	}
+	if r, g, b, _ := img.At(1, 48).RGBA(); uint8(r>>8) != a.Color.R || uint8(g>>8) != a.Color.G || uint8(b>>8) != a.Color.B {
+		t.Fatalf("edge pixel = %d,%d,%d, want %v", r>>8, g>>8, b>>8, a.Color)
+	}
+}
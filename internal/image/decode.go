@@ -0,0 +1,125 @@
+package imagex
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"image"
+	_ "image/gif"  // register GIF for DecodeConfig
+	_ "image/jpeg" // register JPEG for DecodeConfig
+	_ "image/png"  // register PNG for DecodeConfig
+	"math"
+	"strconv"
+	"strings"
+
+	_ "golang.org/x/image/bmp"  // register BMP for DecodeConfig
+	_ "golang.org/x/image/webp" // register WebP for DecodeConfig
+)
+
+var (
+	// ErrUnknownFormat is returned when the bytes are not a recognised image.
+	ErrUnknownFormat = errors.New("imagex: unrecognized image format")
+	// ErrCorrupt is returned when the format is recognised but its header
+	// cannot be decoded.
+	ErrCorrupt = errors.New("imagex: corrupt image header")
+)
+
+// Info describes an image decoded from its bytes.
+// Width and Height are 0 when the format carries no intrinsic size
+// (an SVG without width/height/viewBox) or when it is not decoded (AVIF, TIFF).
+type Info struct {
+	Format Format
+	Width  int
+	Height int
+}
+
+// Decode sniffs the format of data and reads its pixel dimensions.
+// Only headers are parsed; pixel data is never decoded.
+func Decode(data []byte) (Info, error) {
+	f := Sniff(data)
+	if f == "" {
+		return Info{}, ErrUnknownFormat
+	}
+	info := Info{Format: f}
+
+	switch f {
+	case FormatPNG, FormatGIF, FormatJPEG, FormatWebP, FormatBMP:
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return Info{}, ErrCorrupt
+		}
+		info.Width, info.Height = cfg.Width, cfg.Height
+	case FormatICO, FormatCUR:
+		entries, err := ParseICO(data)
+		if err != nil {
+			return Info{}, err
+		}
+		e, err := LargestICOEntry(entries)
+		if err != nil {
+			return Info{}, err
+		}
+		info.Width, info.Height = e.Width, e.Height
+	case FormatSVG:
+		w, h, err := svgSize(data)
+		if err != nil {
+			return Info{}, err
+		}
+		info.Width, info.Height = w, h
+	}
+	return info, nil
+}
+
+// svgSize reads the intrinsic size of an SVG from the root element's
+// width/height attributes (unitless or px), falling back to viewBox.
+func svgSize(data []byte) (int, int, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return 0, 0, ErrCorrupt
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if se.Name.Local != "svg" {
+			return 0, 0, ErrCorrupt
+		}
+		var w, h float64
+		var viewBox string
+		for _, a := range se.Attr {
+			switch a.Name.Local {
+			case "width":
+				w = svgLength(a.Value)
+			case "height":
+				h = svgLength(a.Value)
+			case "viewBox":
+				viewBox = a.Value
+			}
+		}
+		if w > 0 && h > 0 {
+			return int(math.Round(w)), int(math.Round(h)), nil
+		}
+		f := strings.FieldsFunc(viewBox, func(r rune) bool { return r == ' ' || r == ',' || r == '\t' || r == '\n' })
+		if len(f) == 4 {
+			vw, err1 := strconv.ParseFloat(f[2], 64)
+			vh, err2 := strconv.ParseFloat(f[3], 64)
+			if err1 == nil && err2 == nil && vw > 0 && vh > 0 {
+				return int(math.Round(vw)), int(math.Round(vh)), nil
+			}
+		}
+		return 0, 0, nil
+	}
+}
+
+// svgLength parses an absolute SVG length in user units or px.
+// Relative units (%, em) return 0.
+func svgLength(v string) float64 {
+	v = strings.TrimSuffix(strings.TrimSpace(v), "px")
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f <= 0 {
+		return 0
+	}
+	return f
+}
@@ -0,0 +1,90 @@
+package imagex_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	imagex "github.com/kudanilll/favget/internal/image"
+)
+
+func encode(t *testing.T, f func(*bytes.Buffer, image.Image) error, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := f(&buf, image.NewNRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// icoDir builds an ICO header with one directory entry per size.
+// Image data is not included; Decode only reads the directory.
+func icoDir(sizes ...int) []byte {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, [3]uint16{0, 1, uint16(len(sizes))})
+	for _, s := range sizes {
+		_ = binary.Write(&buf, binary.LittleEndian, [4]uint8{uint8(s), uint8(s), 0, 0})
+		_ = binary.Write(&buf, binary.LittleEndian, [2]uint16{1, 32})
+		_ = binary.Write(&buf, binary.LittleEndian, [2]uint32{0, 0})
+	}
+	return buf.Bytes()
+}
+
+// TestDecode checks format sniffing and dimension decoding for each
+// supported container, and that non-images are rejected.
+func TestDecode(t *testing.T) {
+	t.Parallel()
+
+	pngEnc := func(b *bytes.Buffer, m image.Image) error { return png.Encode(b, m) }
+	gifEnc := func(b *bytes.Buffer, m image.Image) error { return gif.Encode(b, m, nil) }
+	jpgEnc := func(b *bytes.Buffer, m image.Image) error { return jpeg.Encode(b, m, nil) }
+
+	tests := []struct {
+		name       string
+		data       []byte
+		wantFormat imagex.Format
+		wantW      int
+		wantH      int
+		wantErr    error
+	}{
+		{"png", encode(t, pngEnc, 32, 16), imagex.FormatPNG, 32, 16, nil},
+		{"gif", encode(t, gifEnc, 20, 10), imagex.FormatGIF, 20, 10, nil},
+		{"jpeg", encode(t, jpgEnc, 64, 64), imagex.FormatJPEG, 64, 64, nil},
+		{"ico-largest-entry", icoDir(16, 48, 32), imagex.FormatICO, 48, 48, nil},
+		{"ico-256-as-zero", icoDir(16, 0), imagex.FormatICO, 256, 256, nil},
+		{"svg-width-height", []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="24px" height="12"/>`), imagex.FormatSVG, 24, 12, nil},
+		{"svg-viewbox", []byte(`<?xml version="1.0"?>
+<!-- logo -->
+<svg viewBox="0 0 100 50"></svg>`), imagex.FormatSVG, 100, 50, nil},
+		{"svg-no-size", []byte(`<svg width="100%"></svg>`), imagex.FormatSVG, 0, 0, nil},
+		{"html-as-png", []byte("<!doctype html><title>404</title>"), "", 0, 0, imagex.ErrUnknownFormat},
+		{"truncated-png", []byte("\x89PNG\r\n\x1a\n\x00"), "", 0, 0, imagex.ErrCorrupt},
+		{"ico-short-directory", icoDir(16)[:10], "", 0, 0, imagex.ErrCorrupt},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			info, err := imagex.Decode(tt.data)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decode() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() unexpected error: %v", err)
+			}
+			if info.Format != tt.wantFormat || info.Width != tt.wantW || info.Height != tt.wantH {
+				t.Fatalf("Decode() = %+v, want %s %dx%d", info, tt.wantFormat, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Package imagex inspects and transforms icon image bytes: format sniffing,
+// dimension decoding and container parsing. It never trusts Content-Type
+// headers; everything is derived from the bytes themselves.
+package imagex
+
+import (
+	"bytes"
+)
+
+// Format is an image container format detected from magic bytes.
+type Format string
+
+const (
+	FormatPNG  Format = "png"
+	FormatGIF  Format = "gif"
+	FormatJPEG Format = "jpeg"
+	FormatWebP Format = "webp"
+	FormatBMP  Format = "bmp"
+	FormatICO  Format = "ico"
+	FormatCUR  Format = "cur"
+	FormatSVG  Format = "svg"
+	FormatAVIF Format = "avif"
+	FormatTIFF Format = "tiff"
+)
+
+// MIME returns the canonical media type for f, or "" for an unknown format.
+func (f Format) MIME() string {
+	switch f {
+	case FormatPNG:
+		return "image/png"
+	case FormatGIF:
+		return "image/gif"
+	case FormatJPEG:
+		return "image/jpeg"
+	case FormatWebP:
+		return "image/webp"
+	case FormatBMP:
+		return "image/bmp"
+	case FormatICO, FormatCUR:
+		return "image/x-icon"
+	case FormatSVG:
+		return "image/svg+xml"
+	case FormatAVIF:
+		return "image/avif"
+	case FormatTIFF:
+		return "image/tiff"
+	}
+	return ""
+}
+
+// Sniff detects the image format of data from its leading bytes.
+// Returns "" if data does not look like a supported image (e.g. an HTML
+// error page served as image/png).
+func Sniff(data []byte) Format {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return FormatGIF
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return FormatJPEG
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return FormatWebP
+	case bytes.HasPrefix(data, []byte("BM")) && len(data) >= 26:
+		return FormatBMP
+	case bytes.HasPrefix(data, []byte{0, 0, 1, 0}) && len(data) >= 6:
+		return FormatICO
+	case bytes.HasPrefix(data, []byte{0, 0, 2, 0}) && len(data) >= 6:
+		return FormatCUR
+	case len(data) >= 12 && string(data[4:8]) == "ftyp" && (string(data[8:12]) == "avif" || string(data[8:12]) == "avis"):
+		return FormatAVIF
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return FormatTIFF
+	case looksLikeSVG(data):
+		return FormatSVG
+	}
+	return ""
+}
+
+// looksLikeSVG reports whether data is an XML document whose root element
+// is <svg>. Leading whitespace, a BOM, the XML declaration, comments and a
+// DOCTYPE are skipped.
+func looksLikeSVG(data []byte) bool {
+	d := bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	for i := 0; i < 16; i++ {
+		d = bytes.TrimLeft(d, " \t\r\n")
+		switch {
+		case bytes.HasPrefix(d, []byte("<?")):
+			end := bytes.Index(d, []byte("?>"))
+			if end < 0 {
+				return false
+			}
+			d = d[end+2:]
+		case bytes.HasPrefix(d, []byte("<!--")):
+			end := bytes.Index(d, []byte("-->"))
+			if end < 0 {
+				return false
+			}
+			d = d[end+3:]
+		case bytes.HasPrefix(d, []byte("<!")):
+			end := bytes.IndexByte(d, '>')
+			if end < 0 {
+				return false
+			}
+			d = d[end+1:]
+		default:
+			return bytes.HasPrefix(d, []byte("<svg")) && len(d) > 4 &&
+				bytes.IndexByte([]byte(" \t\r\n>/"), d[4]) >= 0
+		}
+	}
+	return false
+}
@@ -0,0 +1,286 @@
+package imagex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// ICOEntry describes one image in an ICO/CUR directory.
+type ICOEntry struct {
+	Index    int    // position in the directory
+	Width    int    // pixels; a stored 0 is reported as 256
+	Height   int    // pixels; a stored 0 is reported as 256
+	BitCount int    // bits per pixel; 0 if the directory does not say
+	PNG      bool   // true if the entry embeds a PNG, false for a BMP DIB
+	Offset   uint32 // byte offset of the entry data within the file
+	Size     uint32 // byte length of the entry data
+}
+
+// ErrNoEntry is returned when an ICO has no entry matching a request.
+var ErrNoEntry = errors.New("imagex: no matching ICO entry")
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// ParseICO reads the directory of an ICO or CUR file. Entry data is not
+// decoded, but each entry's bounds are checked against data.
+func ParseICO(data []byte) ([]ICOEntry, error) {
+	if len(data) < 6 {
+		return nil, ErrCorrupt
+	}
+	if binary.LittleEndian.Uint16(data[0:2]) != 0 {
+		return nil, ErrCorrupt
+	}
+	kind := binary.LittleEndian.Uint16(data[2:4])
+	if kind != 1 && kind != 2 {
+		return nil, ErrUnknownFormat
+	}
+	count := int(binary.LittleEndian.Uint16(data[4:6]))
+	if count == 0 || len(data) < 6+16*count {
+		return nil, ErrCorrupt
+	}
+
+	out := make([]ICOEntry, 0, count)
+	for i := 0; i < count; i++ {
+		d := data[6+16*i : 6+16*(i+1)]
+		e := ICOEntry{
+			Index:  i,
+			Width:  int(d[0]),
+			Height: int(d[1]),
+			Size:   binary.LittleEndian.Uint32(d[8:12]),
+			Offset: binary.LittleEndian.Uint32(d[12:16]),
+		}
+		if e.Width == 0 {
+			e.Width = 256
+		}
+		if e.Height == 0 {
+			e.Height = 256
+		}
+		// In CUR files these two fields hold the hotspot instead.
+		if kind == 1 {
+			e.BitCount = int(binary.LittleEndian.Uint16(d[6:8]))
+		}
+		end := uint64(e.Offset) + uint64(e.Size)
+		if end > uint64(len(data)) {
+			return nil, ErrCorrupt
+		}
+		payload := data[e.Offset:end]
+		e.PNG = bytes.HasPrefix(payload, pngSignature)
+		if e.BitCount == 0 && !e.PNG && len(payload) >= 16 {
+			e.BitCount = int(binary.LittleEndian.Uint16(payload[14:16]))
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// LargestICOEntry returns the entry with the most pixels, preferring the
+// higher bit depth on ties.
+func LargestICOEntry(entries []ICOEntry) (ICOEntry, error) {
+	if len(entries) == 0 {
+		return ICOEntry{}, ErrNoEntry
+	}
+	best := entries[0]
+	for _, e := range entries[1:] {
+		if e.Width*e.Height > best.Width*best.Height ||
+			(e.Width*e.Height == best.Width*best.Height && e.BitCount > best.BitCount) {
+			best = e
+		}
+	}
+	return best, nil
+}
+
+// PickICOEntry returns the smallest entry whose shorter edge is at least
+// size, or the largest entry if none is big enough. size <= 0 selects the
+// largest entry.
+func PickICOEntry(entries []ICOEntry, size int) (ICOEntry, error) {
+	largest, err := LargestICOEntry(entries)
+	if err != nil || size <= 0 {
+		return largest, err
+	}
+	var best *ICOEntry
+	for i := range entries {
+		e := &entries[i]
+		if min(e.Width, e.Height) < size {
+			continue
+		}
+		if best == nil || e.Width*e.Height < best.Width*best.Height ||
+			(e.Width*e.Height == best.Width*best.Height && e.BitCount > best.BitCount) {
+			best = e
+		}
+	}
+	if best == nil {
+		return largest, nil
+	}
+	return *best, nil
+}
+
+// DecodeICOEntry decodes a single directory entry to an image.
+func DecodeICOEntry(data []byte, e ICOEntry) (image.Image, error) {
+	payload := data[e.Offset : e.Offset+e.Size]
+	if e.PNG {
+		img, err := png.Decode(bytes.NewReader(payload))
+		if err != nil {
+			return nil, ErrCorrupt
+		}
+		return img, nil
+	}
+	return decodeDIB(payload)
+}
+
+// ExtractICO picks an entry with PickICOEntry and returns it as PNG bytes.
+// Embedded PNG entries are returned as-is; BMP entries are re-encoded.
+// The returned entry carries the real decoded dimensions.
+func ExtractICO(data []byte, size int) ([]byte, ICOEntry, error) {
+	entries, err := ParseICO(data)
+	if err != nil {
+		return nil, ICOEntry{}, err
+	}
+	e, err := PickICOEntry(entries, size)
+	if err != nil {
+		return nil, ICOEntry{}, err
+	}
+
+	if e.PNG {
+		payload := data[e.Offset : e.Offset+e.Size]
+		cfg, err := png.DecodeConfig(bytes.NewReader(payload))
+		if err != nil {
+			return nil, ICOEntry{}, ErrCorrupt
+		}
+		e.Width, e.Height = cfg.Width, cfg.Height
+		return payload, e, nil
+	}
+
+	img, err := decodeDIB(data[e.Offset : e.Offset+e.Size])
+	if err != nil {
+		return nil, ICOEntry{}, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, ICOEntry{}, err
+	}
+	b := img.Bounds()
+	e.Width, e.Height = b.Dx(), b.Dy()
+	return buf.Bytes(), e, nil
+}
+
+// maxDIBEdge bounds decoded DIB dimensions so a hostile header cannot
+// force a huge allocation.
+const maxDIBEdge = 1024
+
+// decodeDIB decodes a BITMAPINFOHEADER DIB as stored inside an ICO: no file
+// header, height doubled to cover the XOR image plus the 1-bit AND mask.
+// Supports uncompressed 1/4/8/24/32 bpp.
+func decodeDIB(p []byte) (image.Image, error) {
+	if len(p) < 40 {
+		return nil, ErrCorrupt
+	}
+	hdrSize := int(binary.LittleEndian.Uint32(p[0:4]))
+	w := int(int32(binary.LittleEndian.Uint32(p[4:8])))
+	h := int(int32(binary.LittleEndian.Uint32(p[8:12])))
+	bpp := int(binary.LittleEndian.Uint16(p[14:16]))
+	compression := binary.LittleEndian.Uint32(p[16:20])
+	clrUsed := int(binary.LittleEndian.Uint32(p[32:36]))
+
+	topDown := h < 0
+	if topDown {
+		h = -h
+	}
+	h /= 2 // XOR + AND masks
+	if hdrSize < 40 || hdrSize > len(p) || w <= 0 || h <= 0 || w > maxDIBEdge || h > maxDIBEdge {
+		return nil, ErrCorrupt
+	}
+	// BI_RGB, or BI_BITFIELDS with the standard 32bpp BGRA layout.
+	if compression != 0 && !(compression == 3 && bpp == 32) {
+		return nil, ErrCorrupt
+	}
+
+	off := hdrSize
+	var palette []color.NRGBA
+	switch bpp {
+	case 1, 4, 8:
+		n := clrUsed
+		if n == 0 || n > 1<<bpp {
+			n = 1 << bpp
+		}
+		if off+4*n > len(p) {
+			return nil, ErrCorrupt
+		}
+		palette = make([]color.NRGBA, n)
+		for i := range palette {
+			c := p[off+4*i:]
+			palette[i] = color.NRGBA{R: c[2], G: c[1], B: c[0], A: 0xff}
+		}
+		off += 4 * n
+	case 24, 32:
+		if compression == 3 && hdrSize == 40 {
+			// The three channel masks follow a BITMAPINFOHEADER; V4/V5
+			// headers carry them inside the header itself.
+			off += 12
+		}
+	default:
+		return nil, ErrCorrupt
+	}
+
+	xorStride := ((w*bpp + 31) / 32) * 4
+	andStride := ((w + 31) / 32) * 4
+	if off+xorStride*h > len(p) {
+		return nil, ErrCorrupt
+	}
+	xor := p[off : off+xorStride*h]
+	var and []byte
+	if end := off + xorStride*h + andStride*h; end <= len(p) {
+		and = p[off+xorStride*h : end]
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	hasAlpha := false
+	for y := 0; y < h; y++ {
+		row := y
+		if !topDown {
+			row = h - 1 - y
+		}
+		src := xor[row*xorStride:]
+		for x := 0; x < w; x++ {
+			var c color.NRGBA
+			switch bpp {
+			case 1:
+				c = palette[int(src[x/8]>>(7-uint(x%8))&1)%len(palette)]
+			case 4:
+				c = palette[int(src[x/2]>>(4*(1-uint(x%2)))&0x0f)%len(palette)]
+			case 8:
+				c = palette[int(src[x])%len(palette)]
+			case 24:
+				c = color.NRGBA{R: src[3*x+2], G: src[3*x+1], B: src[3*x], A: 0xff}
+			case 32:
+				c = color.NRGBA{R: src[4*x+2], G: src[4*x+1], B: src[4*x], A: src[4*x+3]}
+				if c.A != 0 {
+					hasAlpha = true
+				}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	// 32bpp icons carry their own alpha channel; older depths (and 32bpp
+	// icons with an all-zero alpha channel) rely on the AND mask.
+	if bpp != 32 || !hasAlpha {
+		for y := 0; y < h; y++ {
+			row := y
+			if !topDown {
+				row = h - 1 - y
+			}
+			for x := 0; x < w; x++ {
+				i := img.PixOffset(x, y)
+				img.Pix[i+3] = 0xff
+				if and != nil && and[row*andStride+x/8]>>(7-uint(x%8))&1 == 1 {
+					img.Pix[i+3] = 0
+				}
+			}
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,195 @@
+package imagex_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	imagex "github.com/kudanilll/favget/internal/image"
+)
+
+type icoImage struct {
+	w, h, bpp int
+	data      []byte
+}
+
+// buildICO assembles an ICO file from raw entry payloads.
+func buildICO(entries ...icoImage) []byte {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, [3]uint16{0, 1, uint16(len(entries))})
+	off := 6 + 16*len(entries)
+	for _, e := range entries {
+		_ = binary.Write(&buf, binary.LittleEndian, [4]uint8{uint8(e.w), uint8(e.h), 0, 0})
+		_ = binary.Write(&buf, binary.LittleEndian, [2]uint16{1, uint16(e.bpp)})
+		_ = binary.Write(&buf, binary.LittleEndian, [2]uint32{uint32(len(e.data)), uint32(off)})
+		off += len(e.data)
+	}
+	for _, e := range entries {
+		buf.Write(e.data)
+	}
+	return buf.Bytes()
+}
+
+func pngEntry(t *testing.T, size int) icoImage {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, size, size))); err != nil {
+		t.Fatal(err)
+	}
+	return icoImage{size, size, 32, buf.Bytes()}
+}
+
+// bmp1Entry builds a 1bpp w×w DIB: palette {black, white}, every pixel
+// white, with the AND mask marking the top-left pixel transparent.
+func bmp1Entry(w int) icoImage {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, struct {
+		Size         uint32
+		W, H         int32
+		Planes, BPP  uint16
+		Compression  uint32
+		SizeImage    uint32
+		XPPM, YPPM   int32
+		ClrUsed, Imp uint32
+	}{40, int32(w), int32(2 * w), 1, 1, 0, 0, 0, 0, 2, 0})
+	buf.Write([]byte{0, 0, 0, 0, 0xff, 0xff, 0xff, 0})
+	stride := ((w + 31) / 32) * 4
+	for y := 0; y < w; y++ { // XOR: all ones → palette index 1 (white)
+		buf.Write(bytes.Repeat([]byte{0xff}, stride))
+	}
+	for y := 0; y < w; y++ { // AND: bottom-up, so the last row is the top row
+		row := make([]byte, stride)
+		if y == w-1 {
+			row[0] = 0x80
+		}
+		buf.Write(row)
+	}
+	return icoImage{w, w, 1, buf.Bytes()}
+}
+
+// bmp32Entry builds a 32bpp BI_BITFIELDS w×w DIB with every pixel opaque
+// red. hdrSize 40 is a BITMAPINFOHEADER followed by the channel masks; 108
+// and 124 (V4/V5) hold the masks inside the header.
+func bmp32Entry(w, hdrSize int) icoImage {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, struct {
+		Size         uint32
+		W, H         int32
+		Planes, BPP  uint16
+		Compression  uint32
+		SizeImage    uint32
+		XPPM, YPPM   int32
+		ClrUsed, Imp uint32
+	}{uint32(hdrSize), int32(w), int32(2 * w), 1, 32, 3, 0, 0, 0, 0, 0})
+	masks := [4]uint32{0x00ff0000, 0x0000ff00, 0x000000ff, 0xff000000} // R, G, B, A
+	if hdrSize == 40 {
+		_ = binary.Write(&buf, binary.LittleEndian, masks[:3])
+	} else {
+		_ = binary.Write(&buf, binary.LittleEndian, masks)
+		buf.Write(make([]byte, hdrSize-56))
+	}
+	for i := 0; i < w*w; i++ {
+		buf.Write([]byte{0, 0, 0xff, 0xff}) // BGRA
+	}
+	buf.Write(make([]byte, ((w+31)/32)*4*w)) // AND mask: all opaque
+	return icoImage{w, w, 32, buf.Bytes()}
+}
+
+func TestDecodeICOBitfields(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]int{"info": 40, "v4": 108, "v5": 124}
+	for name, hdrSize := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			data := buildICO(bmp32Entry(4, hdrSize))
+			entries, err := imagex.ParseICO(data)
+			if err != nil {
+				t.Fatalf("ParseICO error: %v", err)
+			}
+			img, err := imagex.DecodeICOEntry(data, entries[0])
+			if err != nil {
+				t.Fatalf("DecodeICOEntry error: %v", err)
+			}
+			want := color.NRGBA{0xff, 0, 0, 0xff}
+			b := img.Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					if got := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA); got != want {
+						t.Fatalf("pixel (%d,%d) = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseAndExtractICO(t *testing.T) {
+	t.Parallel()
+
+	data := buildICO(pngEntry(t, 16), bmp1Entry(32), pngEntry(t, 48))
+
+	entries, err := imagex.ParseICO(data)
+	if err != nil {
+		t.Fatalf("ParseICO error: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	if !entries[0].PNG || entries[1].PNG || !entries[2].PNG {
+		t.Fatalf("PNG flags = %v %v %v, want true false true", entries[0].PNG, entries[1].PNG, entries[2].PNG)
+	}
+	if entries[1].BitCount != 1 {
+		t.Fatalf("BMP entry BitCount = %d, want 1", entries[1].BitCount)
+	}
+
+	// Largest entry is returned as the embedded PNG, untouched.
+	out, e, err := imagex.ExtractICO(data, 0)
+	if err != nil {
+		t.Fatalf("ExtractICO(0) error: %v", err)
+	}
+	if e.Index != 2 || e.Width != 48 {
+		t.Fatalf("ExtractICO(0) picked %+v, want 48px entry", e)
+	}
+	if !bytes.Equal(out, data[entries[2].Offset:entries[2].Offset+entries[2].Size]) {
+		t.Fatalf("ExtractICO(0) re-encoded an embedded PNG")
+	}
+
+	// Requesting 20px picks the smallest entry that is big enough: the 32px BMP.
+	out, e, err = imagex.ExtractICO(data, 20)
+	if err != nil {
+		t.Fatalf("ExtractICO(20) error: %v", err)
+	}
+	if e.Index != 1 || e.Width != 32 || e.Height != 32 {
+		t.Fatalf("ExtractICO(20) picked %+v, want 32px BMP entry", e)
+	}
+	img, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("extracted BMP entry is not a PNG: %v", err)
+	}
+	if got := color.NRGBAModel.Convert(img.At(0, 0)).(color.NRGBA); got.A != 0 {
+		t.Fatalf("pixel (0,0) = %v, want transparent from AND mask", got)
+	}
+	if got := color.NRGBAModel.Convert(img.At(1, 0)).(color.NRGBA); got != (color.NRGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Fatalf("pixel (1,0) = %v, want opaque white", got)
+	}
+
+	// Requesting more than any entry offers falls back to the largest.
+	if _, e, _ = imagex.ExtractICO(data, 128); e.Width != 48 {
+		t.Fatalf("ExtractICO(128) picked %dpx, want largest 48px", e.Width)
+	}
+}
+
+func TestParseICORejectsOutOfBoundsEntry(t *testing.T) {
+	t.Parallel()
+
+	data := buildICO(pngEntry(t, 16))
+	data = data[:len(data)-10]
+	if _, err := imagex.ParseICO(data); err != imagex.ErrCorrupt {
+		t.Fatalf("ParseICO error = %v, want ErrCorrupt", err)
+	}
+}
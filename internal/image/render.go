@@ -0,0 +1,180 @@
+package imagex
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+	"golang.org/x/image/draw"
+)
+
+// Rendition limits. ICO directory entries cannot describe more than 256px.
+const (
+	MinRenderSize    = 16
+	MaxRenderSize    = 512
+	MaxICOSize       = 256
+	defaultSVGRaster = 256  // raster size for an SVG when no size is requested
+	maxDecodeEdge    = 4096 // refuse to decode rasters larger than this on either edge
+)
+
+var (
+	// ErrUnsupportedOutput is returned by Render for output formats it cannot write.
+	ErrUnsupportedOutput = errors.New("imagex: unsupported output format")
+	// ErrTooLarge is returned when a source image exceeds the decode limits.
+	ErrTooLarge = errors.New("imagex: image dimensions too large")
+)
+
+// Rasterize decodes data into pixels. size (0 = native) selects the best ICO
+// entry and the resolution an SVG is drawn at.
+func Rasterize(data []byte, size int) (image.Image, error) {
+	switch Sniff(data) {
+	case FormatICO, FormatCUR:
+		entries, err := ParseICO(data)
+		if err != nil {
+			return nil, err
+		}
+		e, err := PickICOEntry(entries, size)
+		if err != nil {
+			return nil, err
+		}
+		return DecodeICOEntry(data, e)
+	case FormatSVG:
+		return rasterizeSVG(data, size)
+	case FormatPNG, FormatGIF, FormatJPEG, FormatWebP, FormatBMP:
+		// Check the header first so a tiny file cannot claim huge dimensions.
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrCorrupt
+		}
+		if cfg.Width > maxDecodeEdge || cfg.Height > maxDecodeEdge {
+			return nil, ErrTooLarge
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrCorrupt
+		}
+		return img, nil
+	case "":
+		return nil, ErrUnknownFormat
+	}
+	return nil, fmt.Errorf("imagex: cannot decode %s", Sniff(data))
+}
+
+// rasterizeSVG draws an SVG into a size×size canvas, preserving aspect ratio.
+func rasterizeSVG(data []byte, size int) (image.Image, error) {
+	if size <= 0 {
+		size = defaultSVGRaster
+	}
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(data), oksvg.IgnoreErrorMode)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	vw, vh := icon.ViewBox.W, icon.ViewBox.H
+	if vw <= 0 || vh <= 0 {
+		vw, vh = float64(size), float64(size)
+	}
+	scale := float64(size) / max(vw, vh)
+	w, h := vw*scale, vh*scale
+	icon.SetTarget((float64(size)-w)/2, (float64(size)-h)/2, w, h)
+
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	scanner := rasterx.NewScannerGV(size, size, img, img.Bounds())
+	icon.Draw(rasterx.NewDasher(size, size, scanner), 1)
+	return img, nil
+}
+
+// Fit scales img to fit a size×size square, preserving aspect ratio and
+// centring it on a transparent canvas.
+func Fit(img image.Image, size int) *image.NRGBA {
+	b := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return dst
+	}
+	w, h := size, size
+	if b.Dx() > b.Dy() {
+		h = max(1, size*b.Dy()/b.Dx())
+	} else if b.Dy() > b.Dx() {
+		w = max(1, size*b.Dx()/b.Dy())
+	}
+	r := image.Rect((size-w)/2, (size-h)/2, (size-w)/2+w, (size-h)/2+h)
+	draw.CatmullRom.Scale(dst, r, img, b, draw.Over, nil)
+	return dst
+}
+
+// Encode writes img in format f. Supported: PNG, WebP (lossless) and ICO
+// (single PNG-compressed entry, at most MaxICOSize on each edge).
+func Encode(img image.Image, f Format) ([]byte, error) {
+	var buf bytes.Buffer
+	switch f {
+	case FormatPNG:
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+	case FormatWebP:
+		if err := nativewebp.Encode(&buf, img, nil); err != nil {
+			return nil, err
+		}
+	case FormatICO:
+		b := img.Bounds()
+		if b.Dx() > MaxICOSize || b.Dy() > MaxICOSize {
+			return nil, fmt.Errorf("imagex: ICO entries are limited to %dpx", MaxICOSize)
+		}
+		var p bytes.Buffer
+		if err := png.Encode(&p, img); err != nil {
+			return nil, err
+		}
+		_ = binary.Write(&buf, binary.LittleEndian, [3]uint16{0, 1, 1})
+		_ = binary.Write(&buf, binary.LittleEndian, [4]uint8{uint8(b.Dx()), uint8(b.Dy()), 0, 0}) // 256 wraps to 0 as the format expects
+		_ = binary.Write(&buf, binary.LittleEndian, [2]uint16{1, 32})
+		_ = binary.Write(&buf, binary.LittleEndian, [2]uint32{uint32(p.Len()), 22})
+		buf.Write(p.Bytes())
+	default:
+		return nil, ErrUnsupportedOutput
+	}
+	return buf.Bytes(), nil
+}
+
+// Render produces a derived rendition of src: scaled to size×size (0 keeps
+// the native size) and encoded as out. SVG output passes an SVG source
+// through SanitizeSVG, with its root sized to size, and wraps raster
+// sources in an SVG <image>.
+func Render(src []byte, size int, out Format) ([]byte, error) {
+	if out == FormatSVG && Sniff(src) == FormatSVG {
+		return sanitizeSVG(src, size)
+	}
+
+	img, err := Rasterize(src, size)
+	if err != nil {
+		return nil, err
+	}
+	if size > 0 {
+		b := img.Bounds()
+		if b.Dx() != size || b.Dy() != size {
+			img = Fit(img, size)
+		}
+	} else if out == FormatICO {
+		if b := img.Bounds(); b.Dx() > MaxICOSize || b.Dy() > MaxICOSize {
+			img = Fit(img, MaxICOSize)
+		}
+	}
+
+	if out != FormatSVG {
+		return Encode(img, out)
+	}
+	p, err := Encode(img, FormatPNG)
+	if err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	return []byte(fmt.Sprintf(
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d"><image width="%d" height="%d" href="data:image/png;base64,%s"/></svg>`,
+		b.Dx(), b.Dy(), b.Dx(), b.Dy(), b.Dx(), b.Dy(), base64.StdEncoding.EncodeToString(p))), nil
+}
@@ -0,0 +1,110 @@
+package imagex_test
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	imagex "github.com/kudanilll/favget/internal/image"
+	"golang.org/x/image/webp"
+)
+
+// TestRender checks that each output format decodes back to the requested
+// size, and that SVG sources are rasterized or passed through as needed.
+func TestRender(t *testing.T) {
+	t.Parallel()
+
+	pngEnc := func(b *bytes.Buffer, m image.Image) error { return png.Encode(b, m) }
+	wide := encode(t, pngEnc, 128, 64)
+	svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><rect width="10" height="10" fill="#f00"/></svg>`)
+	sized := []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="24px" height="12"><rect width="24" height="12" fill="#f00"/></svg>`)
+
+	tests := []struct {
+		name    string
+		src     []byte
+		size    int
+		out     imagex.Format
+		wantFmt imagex.Format
+		wantW   int
+		wantH   int
+	}{
+		{"png-downscale", wide, 32, imagex.FormatPNG, imagex.FormatPNG, 32, 32},
+		{"png-native", wide, 0, imagex.FormatPNG, imagex.FormatPNG, 128, 64},
+		{"png-to-ico", wide, 48, imagex.FormatICO, imagex.FormatICO, 48, 48},
+		{"png-to-webp", wide, 64, imagex.FormatWebP, imagex.FormatWebP, 64, 64},
+		{"svg-to-png", svg, 64, imagex.FormatPNG, imagex.FormatPNG, 64, 64},
+		{"svg-passthrough", svg, 0, imagex.FormatSVG, imagex.FormatSVG, 10, 10},
+		{"svg-resized", svg, 32, imagex.FormatSVG, imagex.FormatSVG, 32, 32},
+		{"svg-resized-without-viewbox", sized, 48, imagex.FormatSVG, imagex.FormatSVG, 48, 48},
+		{"png-wrapped-in-svg", wide, 16, imagex.FormatSVG, imagex.FormatSVG, 16, 16},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := imagex.Render(tt.src, tt.size, tt.out)
+			if err != nil {
+				t.Fatalf("Render error: %v", err)
+			}
+			info, err := imagex.Decode(got)
+			if err != nil {
+				t.Fatalf("Decode(rendition) error: %v", err)
+			}
+			if info.Format != tt.wantFmt || info.Width != tt.wantW || info.Height != tt.wantH {
+				t.Fatalf("rendition = %s %dx%d, want %s %dx%d",
+					info.Format, info.Width, info.Height, tt.wantFmt, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestRenderOutputsDecode(t *testing.T) {
+	t.Parallel()
+
+	svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><rect width="10" height="10" fill="#f00"/></svg>`)
+
+	w, err := imagex.Render(svg, 32, imagex.FormatWebP)
+	if err != nil {
+		t.Fatalf("Render webp error: %v", err)
+	}
+	img, err := webp.Decode(bytes.NewReader(w))
+	if err != nil {
+		t.Fatalf("webp.Decode error: %v", err)
+	}
+	if r, _, _, a := img.At(16, 16).RGBA(); r < 0xf000 || a < 0xf000 {
+		t.Fatalf("centre pixel not opaque red after rasterizing SVG")
+	}
+
+	ico, err := imagex.Render(svg, 64, imagex.FormatICO)
+	if err != nil {
+		t.Fatalf("Render ico error: %v", err)
+	}
+	if _, entry, err := imagex.ExtractICO(ico, 0); err != nil || entry.Width != 64 {
+		t.Fatalf("ExtractICO = %+v, %v; want a 64px entry", entry, err)
+	}
+
+	wrapped, err := imagex.Render(encode(t, func(b *bytes.Buffer, m image.Image) error { return png.Encode(b, m) }, 8, 8), 0, imagex.FormatSVG)
+	if err != nil || !strings.Contains(string(wrapped), "data:image/png;base64,") {
+		t.Fatalf("SVG wrap = %q, %v", wrapped, err)
+	}
+}
+
+// TestRenderSVGKeepsDrawing checks that resizing an SVG without a viewBox
+// derives one from its dimensions, so the drawing scales with the new size.
+func TestRenderSVGKeepsDrawing(t *testing.T) {
+	t.Parallel()
+
+	src := []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="24px" height="12" onload="x()"><rect width="24" height="12"/></svg>`)
+	got, err := imagex.Render(src, 32, imagex.FormatSVG)
+	if err != nil {
+		t.Fatalf("Render error: %v", err)
+	}
+	want := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 12" width="32" height="32">`
+	if !strings.HasPrefix(string(got), want) {
+		t.Fatalf("root = %s, want prefix %s", got, want)
+	}
+}
@@ -0,0 +1,271 @@
+package imagex
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsafeSVG is returned by SanitizeSVG for documents it cannot make safe,
+// e.g. ones relying on custom entities or whose root is not <svg>.
+var ErrUnsafeSVG = errors.New("imagex: SVG cannot be sanitized")
+
+// svgElements lists the elements SanitizeSVG keeps. Anything else —
+// script, foreignObject, iframe, animate/set (which can rewrite href), and
+// elements from editor namespaces — is dropped along with its children.
+var svgElements = map[string]bool{
+	"svg": true, "g": true, "defs": true, "symbol": true, "use": true, "title": true, "desc": true,
+	"path": true, "rect": true, "circle": true, "ellipse": true, "line": true, "polyline": true, "polygon": true,
+	"text": true, "tspan": true, "textPath": true, "image": true, "style": true,
+	"linearGradient": true, "radialGradient": true, "stop": true, "pattern": true, "clipPath": true, "mask": true, "marker": true,
+	"filter": true, "feBlend": true, "feColorMatrix": true, "feComponentTransfer": true, "feComposite": true,
+	"feFlood": true, "feGaussianBlur": true, "feMerge": true, "feMergeNode": true, "feMorphology": true,
+	"feOffset": true, "feDropShadow": true, "feFuncR": true, "feFuncG": true, "feFuncB": true, "feFuncA": true,
+	"animateTransform": true, "animateMotion": true,
+}
+
+const (
+	svgNamespace   = "http://www.w3.org/2000/svg"
+	xlinkNamespace = "http://www.w3.org/1999/xlink"
+)
+
+var (
+	cssComment = regexp.MustCompile(`(?s)/\*.*?(\*/|$)`)
+	cssEscape  = regexp.MustCompile(`(?s)\\([0-9a-fA-F]{1,6}\s?|.|$)`)
+	cssImport  = regexp.MustCompile(`(?i)@import[^;]*;?`)
+	cssURL     = regexp.MustCompile(`(?i)url\(\s*(['"]?)\s*([^)'"]*)(['"]?)\s*\)`)
+)
+
+// SanitizeSVG rewrites an SVG document so it can be served from Favget's own
+// origin. It keeps only allow-listed elements, and removes:
+//   - <script>, <foreignObject> and any other element not in svgElements;
+//   - event handler attributes (on*) and attributes from foreign namespaces;
+//   - href/xlink:href values that are not fragment references (#id) or
+//     raster data: URIs, and url(...) references outside the document;
+//   - DOCTYPEs, processing instructions and comments. Documents that need
+//     entities beyond the XML built-ins are rejected rather than expanded.
+//
+// The text of a <style> element is sanitized as a whole once it is closed,
+// so comments or CDATA sections cannot split a keyword past sanitizeCSS.
+func SanitizeSVG(data []byte) ([]byte, error) {
+	return sanitizeSVG(data, 0)
+}
+
+// sanitizeSVG is SanitizeSVG, additionally sizing the root element to
+// size×size when size > 0 (see sizeSVGRoot).
+func sanitizeSVG(data []byte, size int) ([]byte, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = true
+
+	var out bytes.Buffer
+	var stack []string   // names of open elements being kept
+	var css bytes.Buffer // text of the open <style> element
+	skip := 0            // depth inside a dropped element
+	sawRoot := false
+
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, ErrUnsafeSVG
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if skip > 0 {
+				skip++
+				continue
+			}
+			if !sawRoot {
+				if t.Name.Local != "svg" || (t.Name.Space != "" && t.Name.Space != "svg") {
+					return nil, ErrUnsafeSVG
+				}
+				sawRoot = true
+				if size > 0 {
+					t.Attr = sizeSVGRoot(t.Attr, size)
+				}
+			} else if len(stack) == 0 {
+				return nil, ErrUnsafeSVG // a second root element
+			}
+			inStyle := len(stack) > 0 && stack[len(stack)-1] == "style"
+			if inStyle || (t.Name.Space != "" && t.Name.Space != "svg") || !svgElements[t.Name.Local] {
+				skip = 1
+				continue
+			}
+			out.WriteString("<" + t.Name.Local)
+			for _, a := range t.Attr {
+				if v, ok := sanitizeSVGAttr(t.Name.Local, a); ok {
+					out.WriteString(" " + qualifiedName(a.Name) + `="`)
+					xml.EscapeText(&out, []byte(v))
+					out.WriteString(`"`)
+				}
+			}
+			out.WriteString(">")
+			stack = append(stack, t.Name.Local)
+
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if len(stack) == 0 {
+				return nil, ErrUnsafeSVG
+			}
+			if stack[len(stack)-1] == "style" {
+				xml.EscapeText(&out, []byte(sanitizeCSS(css.String())))
+				css.Reset()
+			}
+			out.WriteString("</" + stack[len(stack)-1] + ">")
+			stack = stack[:len(stack)-1]
+
+		case xml.CharData:
+			if skip > 0 || len(stack) == 0 {
+				continue
+			}
+			if stack[len(stack)-1] == "style" {
+				css.Write(t)
+				continue
+			}
+			xml.EscapeText(&out, t)
+
+		case xml.Directive:
+			// A DOCTYPE may declare entities; none are expanded (strict mode
+			// rejects references to them), and the declaration itself is dropped.
+		}
+		// Comments and processing instructions are dropped.
+	}
+	if !sawRoot || len(stack) != 0 || skip != 0 {
+		return nil, ErrUnsafeSVG
+	}
+	return out.Bytes(), nil
+}
+
+// sizeSVGRoot replaces the width and height of a root <svg> with size. A
+// root without a viewBox gets one from its numeric width and height, so the
+// drawing is scaled rather than cropped; like raster renditions, a
+// non-square drawing is centred in the square.
+func sizeSVGRoot(attrs []xml.Attr, size int) []xml.Attr {
+	var w, h string
+	hasViewBox := false
+	out := make([]xml.Attr, 0, len(attrs)+3)
+	for _, a := range attrs {
+		if a.Name.Space == "" {
+			switch a.Name.Local {
+			case "width":
+				w = a.Value
+				continue
+			case "height":
+				h = a.Value
+				continue
+			case "viewBox":
+				hasViewBox = true
+			}
+		}
+		out = append(out, a)
+	}
+	if !hasViewBox {
+		vw, errW := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(w), "px"), 64)
+		vh, errH := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(h), "px"), 64)
+		if errW == nil && errH == nil && vw > 0 && vh > 0 {
+			out = append(out, xml.Attr{Name: xml.Name{Local: "viewBox"},
+				Value: "0 0 " + strconv.FormatFloat(vw, 'g', -1, 64) + " " + strconv.FormatFloat(vh, 'g', -1, 64)})
+		}
+	}
+	n := strconv.Itoa(size)
+	return append(out,
+		xml.Attr{Name: xml.Name{Local: "width"}, Value: n},
+		xml.Attr{Name: xml.Name{Local: "height"}, Value: n})
+}
+
+// sanitizeSVGAttr returns the value to keep for attribute a on element el,
+// or false to drop it.
+func sanitizeSVGAttr(el string, a xml.Attr) (string, bool) {
+	local := a.Name.Local
+	switch a.Name.Space {
+	case "":
+	case "xmlns":
+		return a.Value, local == "xlink" && a.Value == xlinkNamespace
+	case "xlink":
+		if local != "href" {
+			return "", false
+		}
+	case "xml":
+		return a.Value, local == "space" || local == "lang"
+	default:
+		return "", false
+	}
+
+	lower := strings.ToLower(local)
+	switch {
+	case lower == "xmlns":
+		return a.Value, a.Value == svgNamespace
+	case strings.HasPrefix(lower, "on"):
+		return "", false
+	case lower == "href":
+		return a.Value, safeSVGHref(el, a.Value)
+	case lower == "style":
+		return sanitizeCSS(a.Value), true
+	case lower == "attributename":
+		// animateTransform/animateMotion only ever need transform-like targets.
+		return a.Value, !strings.Contains(strings.ToLower(a.Value), "href")
+	}
+	if strings.Contains(strings.ToLower(a.Value), "url(") {
+		return sanitizeCSS(a.Value), true
+	}
+	return a.Value, true
+}
+
+// safeSVGHref allows in-document references and, on <image>, inline raster
+// data. External documents, javascript: and SVG data: URIs are refused.
+func safeSVGHref(el, v string) bool {
+	v = strings.TrimSpace(v)
+	if strings.HasPrefix(v, "#") {
+		return true
+	}
+	if el != "image" {
+		return false
+	}
+	lower := strings.ToLower(v)
+	for _, p := range []string{"data:image/png", "data:image/jpeg", "data:image/gif", "data:image/webp"} {
+		if strings.HasPrefix(lower, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeCSS drops @import rules and replaces url(...) references that do
+// not point into the document with "none". Comments and escapes are
+// removed first, so neither can hide a keyword (u/**/rl, \75 rl, u\rl),
+// and the rules are reapplied until nothing changes, so a removal cannot
+// join the remaining text into a new one.
+func sanitizeCSS(css string) string {
+	for {
+		next := cssComment.ReplaceAllString(css, "")
+		next = cssEscape.ReplaceAllString(next, "")
+		next = cssImport.ReplaceAllString(next, "")
+		next = cssURL.ReplaceAllStringFunc(next, func(m string) string {
+			if sub := cssURL.FindStringSubmatch(m); strings.HasPrefix(sub[2], "#") {
+				return m
+			}
+			return "none"
+		})
+		if next == css {
+			return css
+		}
+		css = next
+	}
+}
+
+func qualifiedName(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return n.Space + ":" + n.Local
+}
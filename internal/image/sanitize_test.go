@@ -0,0 +1,145 @@
+package imagex_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	imagex "github.com/kudanilll/favget/internal/image"
+)
+
+// TestSanitizeSVG checks that active content and external references are
+// removed while the drawing itself survives.
+func TestSanitizeSVG(t *testing.T) {
+	t.Parallel()
+
+	const open = `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 10 10">`
+
+	tests := []struct {
+		name    string
+		in      string
+		want    []string // substrings that must remain
+		dropped []string // substrings that must be gone
+	}{
+		{
+			name:    "script",
+			in:      open + `<script>alert(1)</script><rect width="10" height="10"/></svg>`,
+			want:    []string{`<rect width="10" height="10">`},
+			dropped: []string{"script", "alert"},
+		},
+		{
+			name:    "cdata-script",
+			in:      open + `<script><![CDATA[alert(1)]]></script></svg>`,
+			dropped: []string{"script", "alert"},
+		},
+		{
+			name:    "event-handlers",
+			in:      open + `<rect onclick="alert(1)" ONLOAD="x()" fill="red"/></svg>`,
+			want:    []string{`fill="red"`},
+			dropped: []string{"onclick", "ONLOAD", "alert"},
+		},
+		{
+			name:    "foreign-object",
+			in:      open + `<foreignObject><body xmlns="http://www.w3.org/1999/xhtml"><iframe src="javascript:alert(1)"/></body></foreignObject><circle r="5"/></svg>`,
+			want:    []string{`<circle r="5">`},
+			dropped: []string{"foreignObject", "iframe", "javascript"},
+		},
+		{
+			name:    "external-hrefs",
+			in:      open + `<use href="https://evil.example/x.svg#a"/><use xlink:href="#local"/><a href="javascript:alert(1)"><text>x</text></a><image href="data:image/svg+xml;base64,PHN2Zy8+"/></svg>`,
+			want:    []string{`<use xlink:href="#local">`, `<image>`},
+			dropped: []string{"evil.example", "javascript", "<a", "svg+xml"},
+		},
+		{
+			name: "raster-data-image",
+			in:   open + `<image href="data:image/png;base64,iVBORw0KGgo="/></svg>`,
+			want: []string{`href="data:image/png;base64,iVBORw0KGgo="`},
+		},
+		{
+			name:    "animate-href",
+			in:      open + `<a><set attributeName="href" to="javascript:alert(1)"/><animate attributeName="href" values="javascript:alert(1)"/></a><animateTransform attributeName="transform" type="rotate"/></svg>`,
+			want:    []string{`<animateTransform attributeName="transform" type="rotate">`},
+			dropped: []string{"javascript", "<set", "<animate "},
+		},
+		{
+			name:    "css-references",
+			in:      open + `<style>@import url(https://evil.example/a.css); .a{fill:url(#g);background:url('https://evil.example/t.png')}</style><rect style="fill:url(https://evil.example/p)" mask="url(#m)"/></svg>`,
+			want:    []string{"fill:url(#g)", `mask="url(#m)"`, "background:none", `style="fill:none"`},
+			dropped: []string{"evil.example", "@import"},
+		},
+		{
+			// XML comments and CDATA split the style text into several
+			// tokens; the keyword must not survive being joined back up.
+			name:    "css-split-by-comments",
+			in:      open + `<style>@imp<!-- x -->ort 'https://evil.example/x.css'; .a{fill:u<!--x-->rl(https://evil.example/a)} .b{fill:u<![CDATA[r]]>l(https://evil.example/b)}</style></svg>`,
+			want:    []string{".a{fill:none}", ".b{fill:none}"},
+			dropped: []string{"evil.example", "@import", "url("},
+		},
+		{
+			name:    "css-escapes",
+			in:      open + `<style>.a{fill:\75 rl(https://evil.example/a)} .b{fill:u\rl(https://evil.example/b)} @\69mport 'https://evil.example/c.css';</style><rect style="fill:u\72l(https://evil.example/d)"/></svg>`,
+			dropped: []string{`\`, "url(", "import"},
+		},
+		{
+			name:    "css-comments-and-joins",
+			in:      open + `<style>@imp/**/ort 'https://evil.example/a.css'; .a{fill:u/* */rl(https://evil.example/b)} @im@import x;port 'https://evil.example/c.css';</style></svg>`,
+			dropped: []string{"evil.example", "@import", "url("},
+		},
+		{
+			name:    "comments-and-doctype",
+			in:      `<?xml version="1.0"?><!DOCTYPE svg PUBLIC "-//W3C//DTD SVG 1.1//EN" "http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd"><!-- hi -->` + open + `<path d="M0 0h10"/></svg>`,
+			want:    []string{`<path d="M0 0h10">`},
+			dropped: []string{"DOCTYPE", "hi", "<?xml"},
+		},
+		{
+			name:    "editor-namespaces",
+			in:      `<svg xmlns="http://www.w3.org/2000/svg" xmlns:inkscape="http://www.inkscape.org/namespaces/inkscape" inkscape:version="1"><inkscape:grid/><g inkscape:label="L"><rect width="1"/></g></svg>`,
+			want:    []string{`<g><rect width="1"></rect></g>`},
+			dropped: []string{"inkscape"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			out, err := imagex.SanitizeSVG([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("SanitizeSVG: %v", err)
+			}
+			got := string(out)
+			for _, s := range tt.want {
+				if !strings.Contains(got, s) {
+					t.Errorf("output lacks %q:\n%s", s, got)
+				}
+			}
+			for _, s := range tt.dropped {
+				if strings.Contains(got, s) {
+					t.Errorf("output still contains %q:\n%s", s, got)
+				}
+			}
+			if f := imagex.Sniff(out); f != imagex.FormatSVG {
+				t.Errorf("sanitized output sniffs as %q", f)
+			}
+		})
+	}
+}
+
+func TestSanitizeSVGRejects(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"entity-expansion": `<!DOCTYPE svg [<!ENTITY a "aaaaaaaa"><!ENTITY b "&a;&a;&a;">]><svg xmlns="http://www.w3.org/2000/svg"><text>&b;</text></svg>`,
+		"external-entity":  `<!DOCTYPE svg [<!ENTITY x SYSTEM "file:///etc/passwd">]><svg xmlns="http://www.w3.org/2000/svg"><text>&x;</text></svg>`,
+		"not-svg":          `<html><script>alert(1)</script></html>`,
+		"malformed":        `<svg xmlns="http://www.w3.org/2000/svg"><rect>`,
+		"two-roots":        `<svg xmlns="http://www.w3.org/2000/svg"/><svg xmlns="http://www.w3.org/2000/svg"/>`,
+	}
+	for name, in := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := imagex.SanitizeSVG([]byte(in)); !errors.Is(err, imagex.ErrUnsafeSVG) {
+				t.Fatalf("err = %v, want ErrUnsafeSVG", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package resolver
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// TestDocumentBaseResolution checks how link hrefs resolve against the
+// response URL, <base href> and protocol-relative references.
+func TestDocumentBaseResolution(t *testing.T) {
+	t.Parallel()
+
+	page, _ := url.Parse("https://www.example.com/en/home")
+
+	tests := []struct {
+		name    string
+		head    string
+		wantURL string
+	}{
+		{"relative-to-page", `<link rel="icon" href="icon.png">`, "https://www.example.com/en/icon.png"},
+		{"root-relative", `<link rel="icon" href="/icon.png">`, "https://www.example.com/icon.png"},
+		{"base-path", `<base href="/static/v2/"><link rel="icon" href="icon.png">`, "https://www.example.com/static/v2/icon.png"},
+		{"base-absolute", `<base href="https://assets.example.net/site/"><link rel="icon" href="img/icon.png">`, "https://assets.example.net/site/img/icon.png"},
+		{"base-protocol-relative", `<base href="//cdn.example.org/p/"><link rel="icon" href="icon.png">`, "https://cdn.example.org/p/icon.png"},
+		{"first-base-wins", `<base href="/a/"><base href="/b/"><link rel="icon" href="icon.png">`, "https://www.example.com/a/icon.png"},
+		{"base-bad-scheme", `<base href="javascript:alert(1)"><link rel="icon" href="icon.png">`, "https://www.example.com/en/icon.png"},
+		{"protocol-relative-href", `<link rel="icon" href="//cdn.example.com/icon.png">`, "https://cdn.example.com/icon.png"},
+		{"data-uri-verbatim", `<base href="/x/"><link rel="icon" href="data:image/svg+xml,<svg fill='#f00'/>">`, "data:image/svg+xml,<svg fill='#f00'/>"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><head>" + tt.head + "</head></html>"))
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			set := newCandidateSet()
+			collectLinkCandidates(doc, documentBase(doc, page), set)
+			if len(set.list) != 1 || set.list[0].URL != tt.wantURL {
+				t.Fatalf("candidates = %+v, want one with URL %q", set.list, tt.wantURL)
+			}
+		})
+	}
+}
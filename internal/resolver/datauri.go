@@ -0,0 +1,109 @@
+package resolver
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+var (
+	errDataURIMalformed = errors.New("malformed data URI")
+	errDataURITooLarge  = errors.New("icon too large")
+)
+
+// isDataURI reports whether s is an RFC 2397 data: URI.
+func isDataURI(s string) bool {
+	return len(s) >= 5 && strings.EqualFold(s[:5], "data:")
+}
+
+// dataURIMediaType returns the declared media type of a data: URI without
+// decoding its payload.
+func dataURIMediaType(s string) string {
+	header, _, _ := strings.Cut(s[5:], ",")
+	mt, _, _ := strings.Cut(header, ";")
+	return normalizeType(mt)
+}
+
+// decodeDataURI splits an RFC 2397 data: URI into its media type (without
+// parameters, lower-cased) and payload, decoding base64 or percent-encoding.
+// Payloads that would exceed maxBytes are rejected before decoding.
+func decodeDataURI(s string, maxBytes int64) (string, []byte, error) {
+	if !isDataURI(s) {
+		return "", nil, errDataURIMalformed
+	}
+	header, payload, ok := strings.Cut(s[5:], ",")
+	if !ok {
+		return "", nil, errDataURIMalformed
+	}
+
+	params := strings.Split(header, ";")
+	mediaType := dataURIMediaType(s)
+	isBase64 := false
+	for _, p := range params[1:] {
+		if strings.EqualFold(strings.TrimSpace(p), "base64") {
+			isBase64 = true
+		}
+	}
+
+	var data []byte
+	if isBase64 {
+		// HTML attribute values often carry line breaks and spaces in long payloads.
+		payload = strings.Map(func(r rune) rune {
+			switch r {
+			case ' ', '\t', '\n', '\r', '\f':
+				return -1
+			}
+			return r
+		}, payload)
+		if p, err := url.PathUnescape(payload); err == nil {
+			payload = p // some generators percent-encode '+', '/' and '='
+		}
+		if int64(base64.StdEncoding.DecodedLen(len(payload))) > maxBytes+2 {
+			return "", nil, errDataURITooLarge
+		}
+		var err error
+		data, err = base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			if data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "=")); err != nil {
+				return "", nil, errDataURIMalformed
+			}
+		}
+	} else {
+		if int64(len(payload)) > 3*maxBytes {
+			return "", nil, errDataURITooLarge
+		}
+		p, err := url.PathUnescape(payload)
+		if err != nil {
+			return "", nil, errDataURIMalformed
+		}
+		data = []byte(p)
+	}
+	if int64(len(data)) > maxBytes {
+		return "", nil, errDataURITooLarge
+	}
+	return mediaType, data, nil
+}
+
+// decodeDataCandidate turns an inline data: icon into a Meta as if it had
+// been downloaded. The declared media type must be an allowed image type,
+// and the bytes must sniff and decode like any fetched icon.
+func (r *Resolver) decodeDataCandidate(s string) (Meta, Probe) {
+	p := Probe{URL: s}
+	mediaType, data, err := decodeDataURI(s, r.MaxIconBytes)
+	if err != nil {
+		reason := ReasonDataURI
+		if errors.Is(err, errDataURITooLarge) {
+			reason = ReasonTooLarge
+		}
+		p.fail(reason, err.Error())
+		return Meta{}, p
+	}
+	p.ContentType = mediaType
+	if !isAllowedContentType(mediaType) {
+		p.fail(ReasonContentType, "content type not allowed")
+		return Meta{}, p
+	}
+	meta, _ := r.decodeIcon(s, data, &p)
+	return meta, p
+}
@@ -0,0 +1,112 @@
+package resolver
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecodeDataURI(t *testing.T) {
+	t.Parallel()
+
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 100 100"><text y=".9em" font-size="90">🎯</text></svg>`
+	b64 := base64.StdEncoding.EncodeToString([]byte(svg))
+
+	tests := []struct {
+		name     string
+		uri      string
+		wantType string
+		wantData string
+		wantErr  error
+	}{
+		{"percent-encoded", "data:image/svg+xml," + strings.ReplaceAll(svg, `"`, "%22"), "image/svg+xml", svg, nil},
+		{"raw-utf8-with-hash", `data:image/svg+xml;utf8,<svg fill="#f00"/>`, "image/svg+xml", `<svg fill="#f00"/>`, nil},
+		{"base64", "data:image/svg+xml;base64," + b64, "image/svg+xml", svg, nil},
+		{"base64-wrapped", "DATA:Image/SVG+XML;charset=utf-8;base64," + b64[:20] + "\n  " + b64[20:], "image/svg+xml", svg, nil},
+		{"base64-unpadded", "data:image/png;base64," + strings.TrimRight(base64.StdEncoding.EncodeToString([]byte("ab")), "="), "image/png", "ab", nil},
+		{"no-comma", "data:image/png;base64", "", "", errDataURIMalformed},
+		{"bad-base64", "data:image/png;base64,!!!", "", "", errDataURIMalformed},
+		{"bad-percent", "data:image/svg+xml,%zz", "", "", errDataURIMalformed},
+		{"too-large", "data:image/png;base64," + base64.StdEncoding.EncodeToString(make([]byte, 2048)), "", "", errDataURITooLarge},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			mt, data, err := decodeDataURI(tt.uri, 1024)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if mt != tt.wantType || string(data) != tt.wantData {
+				t.Fatalf("got %q %q, want %q %q", mt, data, tt.wantType, tt.wantData)
+			}
+		})
+	}
+}
+
+// TestDataURICandidates checks that inline icons are ranked, decoded and
+// chosen like fetched ones, and that non-image media types are refused.
+func TestDataURICandidates(t *testing.T) {
+	t.Parallel()
+
+	r := New(false, 0, false)
+	emoji := `data:image/svg+xml,<svg xmlns=%22http://www.w3.org/2000/svg%22 viewBox=%220 0 100 100%22><text y=%22.9em%22 font-size=%2290%22 fill="#333">🎯</text></svg>`
+
+	c := Candidate{Href: emoji, URL: emoji, Rel: RelIcon}
+	if c.format() != "svg" {
+		t.Fatalf("format() = %q, want svg from the data URI media type", c.format())
+	}
+	m, ok := r.probeCandidate(context.Background(), &c, pageInfo{URL: "https://example.com/", Scheme: "https", final: "https"})
+	if !ok {
+		t.Fatalf("probe failed: %+v", *c.Probe)
+	}
+	if m.SourceURL != emoji || m.Format != "svg" || m.Width == nil || *m.Width != 100 || !strings.Contains(string(m.Data), "🎯") {
+		t.Fatalf("meta = %+v", m)
+	}
+
+	html := Candidate{URL: "data:text/html;base64," + base64.StdEncoding.EncodeToString([]byte("<svg/>"))}
+	if _, ok := r.probeCandidate(context.Background(), &html, pageInfo{}); ok || html.Probe.Err != "content type not allowed" {
+		t.Fatalf("text/html data URI accepted: %+v", *html.Probe)
+	}
+}
+
+// TestRasterizeSVG checks that with RasterizeSVG an SVG candidate is handed
+// out as its PNG rendering, with the rendering's dimensions, and that one
+// that cannot be rendered is rejected rather than passed on as SVG.
+func TestRasterizeSVG(t *testing.T) {
+	t.Parallel()
+
+	page := pageInfo{URL: "https://example.com/", Scheme: "https", final: "https"}
+	good := `data:image/svg+xml,<svg xmlns=%22http://www.w3.org/2000/svg%22 viewBox=%220 0 10 10%22><rect width=%2210%22 height=%2210%22/></svg>`
+	bad := `data:image/svg+xml,<svg xmlns=%22http://www.w3.org/2000/svg%22 viewBox=%220 0 10 10%22><rect width=%2210%22 height=%2210%22 fill=%22bogus%22/></svg>`
+
+	r := New(false, 0, false)
+	r.RasterizeSVG = true
+
+	c := Candidate{URL: good, Rel: RelIcon}
+	m, ok := r.probeCandidate(context.Background(), &c, page)
+	if !ok {
+		t.Fatalf("probe failed: %+v", *c.Probe)
+	}
+	if m.Format != "png" || m.ContentType == nil || *m.ContentType != "image/png" || m.Width == nil || *m.Width != 256 || *m.Height != 256 {
+		t.Fatalf("meta = %+v, want a 256px PNG", m)
+	}
+	if c.Probe.Format != "svg" {
+		t.Fatalf("probe format = %q, want the upstream svg", c.Probe.Format)
+	}
+
+	c = Candidate{URL: bad, Rel: RelIcon}
+	if _, ok := r.probeCandidate(context.Background(), &c, page); ok || c.Probe.Reason != ReasonUndecodable {
+		t.Fatalf("unrenderable SVG accepted: %+v", *c.Probe)
+	}
+
+	// Without rasterizing, the same SVG is served as sanitized markup.
+	c = Candidate{URL: bad, Rel: RelIcon}
+	if m, ok := New(false, 0, false).probeCandidate(context.Background(), &c, page); !ok || m.Format != "svg" {
+		t.Fatalf("sanitize mode: ok=%v meta=%+v", ok, m)
+	}
+}
@@ -0,0 +1,40 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned (wrapped) when a URL resolves to, or a
+// connection would reach, a private or reserved IP address.
+var ErrBlockedAddress = errors.New("reserved/private IP not allowed")
+
+// newDialer returns a dialer that re-checks the address it actually connects
+// to. validateURL resolves the host once up front, but the HTTP client
+// resolves it again when dialing, so a DNS-rebinding host could answer with a
+// public IP first and a private one second. Checking in Control runs after
+// that second resolution, for every connection the client opens, including
+// those made while following redirects.
+func (r *Resolver) newDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: -1,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return fmt.Errorf("%w: unresolved address %q", ErrBlockedAddress, address)
+			}
+			if r.isPrivateIP(ip.String()) || ip.IsUnspecified() || ip.IsMulticast() {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, ip)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,55 @@
+package resolver
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestDialerBlocksPrivateAddresses exercises the connect-time check directly
+// through the default client, bypassing validateURL as a rebinding host would.
+// The redirect case is also caught earlier by the redirect policy.
+func TestDialerBlocksPrivateAddresses(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			// 0.0.0.0 reaches the local host on Linux; it must be refused
+			// even when loopback is allowed.
+			http.Redirect(w, r, "http://0.0.0.0:"+r.Host[strings.LastIndex(r.Host, ":")+1:]+"/ok", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(ts.Close)
+
+	tests := []struct {
+		name          string
+		allowLoopback bool
+		path          string
+		wantBlocked   bool
+	}{
+		{"loopback-blocked", false, "/ok", true},
+		{"loopback-allowed", true, "/ok", false},
+		{"redirect-to-unspecified", true, "/redirect", true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := New(false, 0, tt.allowLoopback)
+			r.SchemePolicy = SchemeHTTPAllowed // the test server is plain HTTP
+			resp, err := r.Client.Get(ts.URL + tt.path)
+			if resp != nil {
+				resp.Body.Close()
+			}
+			if got := errors.Is(err, ErrBlockedAddress); got != tt.wantBlocked {
+				t.Fatalf("blocked = %v (err %v), want %v", got, err, tt.wantBlocked)
+			}
+		})
+	}
+}
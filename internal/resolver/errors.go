@@ -0,0 +1,145 @@
+package resolver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Reason is a machine-readable cause for a failed resolution or a rejected
+// candidate. Values are stable and meant to be matched by API clients.
+type Reason string
+
+// Page-level reasons (why no icon could be looked for).
+const (
+	ReasonDNS              Reason = "dns_failure"        // the host does not resolve
+	ReasonBlockedAddress   Reason = "blocked_address"    // resolves to a private/reserved IP
+	ReasonInsecureScheme   Reason = "insecure_scheme"    // plain HTTP forbidden by SchemePolicy
+	ReasonTLS              Reason = "tls_error"          // handshake or certificate failure
+	ReasonTimeout          Reason = "timeout"            // deadline exceeded
+	ReasonTooManyRedirects Reason = "too_many_redirects" // more than MaxRedirects hops
+	ReasonUnreachable      Reason = "unreachable"        // any other transport failure
+	ReasonHTMLTooLarge     Reason = "html_too_large"     // no icons within the first MaxHTMLBytes
+	ReasonNoCandidates     Reason = "no_candidates"      // page declares no icons and /favicon.ico failed
+	ReasonAllRejected      Reason = "candidates_rejected"
+)
+
+// Candidate-level reasons, recorded in Probe.Reason. A transport failure
+// while fetching a candidate uses the page-level reason for it.
+const (
+	ReasonInvalidURL  Reason = "invalid_url"
+	ReasonHTTPStatus  Reason = "http_status"  // non-2xx/3xx response
+	ReasonContentType Reason = "content_type" // Content-Type is not an allowed image type
+	ReasonTooLarge    Reason = "too_large"    // more than MaxIconBytes
+	ReasonUndecodable Reason = "undecodable"  // bytes are not a supported image
+	ReasonUnsafeSVG   Reason = "unsafe_svg"   // SVG could not be sanitized
+	ReasonDataURI     Reason = "invalid_data_uri"
+)
+
+// Error is returned by ResolveBestIcon and Revalidate when no icon could be
+// resolved. Rejected lists every candidate that was probed, in rank order,
+// when Reason is ReasonAllRejected or ReasonNoCandidates.
+type Error struct {
+	Domain   string
+	Reason   Reason
+	Rejected []Rejection
+	Err      error // underlying cause, if any
+}
+
+// Rejection is why a single candidate was not used.
+type Rejection struct {
+	URL    string
+	Reason Reason
+	Status int // HTTP status, when a response was received
+	Detail string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("resolve %s: %s", e.Domain, e.Reason)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// ReasonOf returns the Reason carried by err, classifying raw transport
+// errors when err is not an *Error. It returns "" for nil.
+func ReasonOf(err error) Reason {
+	if err == nil {
+		return ""
+	}
+	var re *Error
+	if errors.As(err, &re) {
+		return re.Reason
+	}
+	return classify(err)
+}
+
+// classify maps a fetch error to a page-level Reason.
+func classify(err error) Reason {
+	var (
+		dnsErr     *net.DNSError
+		netErr     net.Error
+		certErr    *tls.CertificateVerificationError
+		unknownCA  x509.UnknownAuthorityError
+		hostErr    x509.HostnameError
+		invalidErr x509.CertificateInvalidError
+		recordErr  tls.RecordHeaderError
+		alertErr   tls.AlertError
+	)
+	switch {
+	case errors.Is(err, ErrBlockedAddress):
+		return ReasonBlockedAddress
+	case errors.Is(err, ErrInsecureScheme):
+		return ReasonInsecureScheme
+	case errors.Is(err, ErrTooManyRedirects):
+		return ReasonTooManyRedirects
+	case errors.As(err, &dnsErr):
+		return ReasonDNS
+	case errors.As(err, &certErr), errors.As(err, &unknownCA), errors.As(err, &hostErr),
+		errors.As(err, &invalidErr), errors.As(err, &recordErr), errors.As(err, &alertErr):
+		return ReasonTLS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ReasonTimeout
+	case strings.Contains(err.Error(), "tls: "):
+		// Handshake failures without an exported error type.
+		return ReasonTLS
+	}
+	return ReasonUnreachable
+}
+
+// pageError wraps a failure to fetch or parse the home page.
+func pageError(target string, err error) error {
+	return &Error{Domain: target, Reason: classify(err), Err: err}
+}
+
+// candidatesError builds the error for a page whose candidates all failed.
+// Only the implicit /favicon.ico having been tried means the page declared
+// no icons; if its HTML was also cut off at MaxHTMLBytes, the icons may
+// simply have been beyond the limit.
+func candidatesError(target string, candidates []Candidate, page pageInfo) error {
+	e := &Error{Domain: target, Reason: ReasonAllRejected}
+	declared := false
+	for _, c := range candidates {
+		if c.Rel != RelFallback {
+			declared = true
+		}
+		if c.Probe == nil {
+			continue
+		}
+		e.Rejected = append(e.Rejected, Rejection{URL: c.Probe.URL, Reason: c.Probe.Reason, Status: c.Probe.Status, Detail: c.Probe.Err})
+	}
+	if !declared {
+		e.Reason = ReasonNoCandidates
+		if page.truncated {
+			e.Reason = ReasonHTMLTooLarge
+		}
+	}
+	return e
+}
@@ -0,0 +1,105 @@
+package resolver_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kudanilll/favget/internal/resolver"
+)
+
+// TestResolveErrorReasons checks that page-level failures are classified.
+func TestResolveErrorReasons(t *testing.T) {
+	t.Parallel()
+
+	tlsSite := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(tlsSite.Close)
+
+	tests := []struct {
+		name          string
+		target        string
+		allowLoopback bool
+		want          resolver.Reason
+	}{
+		{"blocked", "localhost", false, resolver.ReasonBlockedAddress},
+		{"dns", "does-not-exist.invalid", false, resolver.ReasonDNS},
+		{"tls", strings.TrimPrefix(tlsSite.URL, "https://"), true, resolver.ReasonTLS},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := resolver.New(false, 0, tt.allowLoopback)
+			_, _, err := r.ResolveBestIcon(context.Background(), tt.target)
+			var re *resolver.Error
+			if !errors.As(err, &re) {
+				t.Fatalf("err = %v (%T), want *resolver.Error", err, err)
+			}
+			if re.Reason != tt.want || resolver.ReasonOf(err) != tt.want {
+				t.Fatalf("reason = %q, want %q (%v)", re.Reason, tt.want, err)
+			}
+		})
+	}
+}
+
+// TestResolveRejectedCandidates checks the per-candidate reasons reported
+// when a page is reachable but none of its icons are usable.
+func TestResolveRejectedCandidates(t *testing.T) {
+	home := `<!doctype html><head>
+<link rel="icon" href="/page.png">
+<link rel="icon" href="data:image/png;base64,!!!">
+</head>`
+	extra := map[string]http.HandlerFunc{
+		"/page.png": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html>not an image</html>"))
+		},
+		"/favicon.ico": func(w http.ResponseWriter, r *http.Request) {
+			http.NotFound(w, r)
+		},
+	}
+	domain, client, cleanup := startTLSSite(t, home, extra)
+	defer cleanup()
+
+	r := resolver.New(true, 1<<20, true)
+	r.SetClient(client)
+
+	_, _, err := r.ResolveBestIcon(context.Background(), domain)
+	var re *resolver.Error
+	if !errors.As(err, &re) || re.Reason != resolver.ReasonAllRejected {
+		t.Fatalf("err = %v, want candidates_rejected", err)
+	}
+	got := map[resolver.Reason]bool{}
+	for _, c := range re.Rejected {
+		got[c.Reason] = true
+	}
+	for _, want := range []resolver.Reason{resolver.ReasonContentType, resolver.ReasonDataURI, resolver.ReasonHTTPStatus} {
+		if !got[want] {
+			t.Errorf("rejections %+v lack %q", re.Rejected, want)
+		}
+	}
+
+	// A page that declares nothing, and whose icons may have been cut off
+	// by the HTML limit, says so instead of "no candidates".
+	padded := "<!doctype html><head>" + strings.Repeat("<meta name=x content=y>", 100) + `<link rel="icon" href="/late.png"></head>`
+	domain, client, cleanup2 := startTLSSite(t, padded, map[string]http.HandlerFunc{"/favicon.ico": http.NotFound})
+	defer cleanup2()
+
+	for _, tc := range []struct {
+		limit int64
+		want  resolver.Reason
+	}{
+		{64, resolver.ReasonHTMLTooLarge},
+		{1 << 20, resolver.ReasonAllRejected},
+	} {
+		r := resolver.New(true, tc.limit, true)
+		r.SetClient(client)
+		if _, _, err := r.ResolveBestIcon(context.Background(), domain); resolver.ReasonOf(err) != tc.want {
+			t.Errorf("limit %d: reason = %q, want %q", tc.limit, resolver.ReasonOf(err), tc.want)
+		}
+	}
+}
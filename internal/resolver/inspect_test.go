@@ -0,0 +1,63 @@
+package resolver_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kudanilll/favget/internal/resolver"
+)
+
+// TestInspect verifies that every candidate is probed (not just the winner)
+// and that Chosen points at the icon ResolveBestIcon would return.
+func TestInspect(t *testing.T) {
+	home := `<!doctype html><head>
+<link rel="icon" href="/missing.png" sizes="256x256">
+<link rel="icon" href="/ok.png" sizes="32x32">
+</head>`
+	extra := map[string]http.HandlerFunc{
+		"/missing.png": func(w http.ResponseWriter, r *http.Request) {
+			http.NotFound(w, r)
+		},
+		"/ok.png": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			w.Header().Set("ETag", `"abc"`)
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(testPNG(32, 32))
+		},
+		"/favicon.ico": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/x-icon")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(testICO(16))
+		},
+	}
+	domain, client, cleanup := startTLSSite(t, home, extra)
+	defer cleanup()
+
+	r := resolver.New(true, 1<<20, true)
+	r.SetClient(client)
+
+	rep, err := r.Inspect(context.Background(), domain)
+	if err != nil {
+		t.Fatalf("Inspect(%q) error: %v", domain, err)
+	}
+	if len(rep.Candidates) != 3 {
+		t.Fatalf("got %d candidates, want 3", len(rep.Candidates))
+	}
+	for _, c := range rep.Candidates {
+		if c.Probe == nil {
+			t.Fatalf("candidate %q was not probed", c.URL)
+		}
+	}
+	if rep.Candidates[0].Probe.OK || rep.Candidates[0].Probe.Status != http.StatusNotFound {
+		t.Fatalf("first candidate probe = %+v, want 404 rejection", *rep.Candidates[0].Probe)
+	}
+	if rep.Chosen != 1 {
+		t.Fatalf("Chosen = %d, want 1", rep.Chosen)
+	}
+	chosen := rep.Candidates[rep.Chosen]
+	if !strings.HasSuffix(chosen.URL, "/ok.png") || chosen.Probe.ETag != `"abc"` {
+		t.Fatalf("chosen = %q (etag %q), want /ok.png with etag", chosen.URL, chosen.Probe.ETag)
+	}
+}
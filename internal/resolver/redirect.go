@@ -0,0 +1,51 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// DefaultMaxRedirects is the hop limit used when Resolver.MaxRedirects is 0.
+const DefaultMaxRedirects = 5
+
+// ErrTooManyRedirects is returned (wrapped) when a fetch exceeds MaxRedirects.
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// checkRedirect is the client's redirect policy: at most MaxRedirects hops,
+// http/https only (plain HTTP only where the scheme policy allows it), and
+// every hop must pass the same SSRF validation as the first request. The
+// dialer re-checks the address at connect time as well.
+func (r *Resolver) checkRedirect(req *http.Request, via []*http.Request) error {
+	limit := r.MaxRedirects
+	if limit <= 0 {
+		limit = DefaultMaxRedirects
+	}
+	if len(via) > limit {
+		return fmt.Errorf("%w (max %d)", ErrTooManyRedirects, limit)
+	}
+	if req.URL.Scheme == "http" && !r.allowHTTP(via[0].URL.Scheme) {
+		return fmt.Errorf("redirect to %s: %w", req.URL.Redacted(), ErrInsecureScheme)
+	}
+	if err := r.validateURL(req.Context(), req.URL); err != nil {
+		return fmt.Errorf("redirect to %s: %w", req.URL.Redacted(), err)
+	}
+	return nil
+}
+
+// redirectChain returns the URLs visited to produce resp, from the first
+// request to the final one. It is empty when no redirect was followed.
+func redirectChain(resp *http.Response) []string {
+	var chain []string
+	for req := resp.Request; req != nil; {
+		chain = append([]string{req.URL.String()}, chain...)
+		if req.Response == nil {
+			break
+		}
+		req = req.Response.Request
+	}
+	if len(chain) < 2 {
+		return nil
+	}
+	return chain
+}
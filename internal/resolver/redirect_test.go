@@ -0,0 +1,87 @@
+package resolver_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kudanilll/favget/internal/resolver"
+)
+
+// TestRedirectPolicy checks that the page's final URL is used as the base
+// for relative hrefs, that the chain is reported, and that hops to other
+// schemes, reserved addresses or past the hop limit are refused.
+func TestRedirectPolicy(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/en/", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/en/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<link rel="icon" href="icon.png" sizes="32x32">`))
+	})
+	mux.HandleFunc("/en/icon.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(testPNG(32, 32))
+	})
+	ts := httptest.NewTLSServer(mux)
+	defer ts.Close()
+	hostPort := strings.TrimPrefix(ts.URL, "https://")
+
+	// Route every hostname to the test server; CheckRedirect is left unset
+	// so SetClient installs the resolver's policy.
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec // test cert only
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, hostPort)
+		},
+	}}
+	r := resolver.New(true, 1<<20, true)
+	r.SetClient(client)
+
+	src, meta, err := r.ResolveBestIcon(context.Background(), hostPort)
+	if err != nil {
+		t.Fatalf("ResolveBestIcon error: %v", err)
+	}
+	if want := ts.URL + "/en/icon.png"; src != want {
+		t.Fatalf("src = %q, want %q (relative to the final page URL)", src, want)
+	}
+	if meta.PageURL != ts.URL+"/en/" || len(meta.Redirects) != 2 || meta.Redirects[0] != ts.URL {
+		t.Fatalf("PageURL = %q, Redirects = %v; want %s/en/ via 2-hop chain", meta.PageURL, meta.Redirects, ts.URL)
+	}
+
+	tests := []struct {
+		name    string
+		target  string
+		wantErr error
+	}{
+		{"non-http-scheme", "ftp://example.com/", nil},
+		{"reserved-address", "https://0.0.0.0/", nil},
+		{"too-many-hops", "/loop", resolver.ErrTooManyRedirects},
+	}
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux.HandleFunc("/"+tt.name, func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, tt.target, http.StatusFound)
+			})
+			resp, err := client.Get(ts.URL + "/" + tt.name)
+			if resp != nil {
+				resp.Body.Close()
+			}
+			if err == nil {
+				t.Fatalf("redirect to %q was followed", tt.target)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
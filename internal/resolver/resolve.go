@@ -1,6 +1,7 @@
 package resolver
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"errors"
@@ -9,17 +10,28 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+
+	imagex "github.com/kudanilll/favget/internal/image"
 )
 
 type Meta struct {
 	SourceURL   string
 	Width       *int32
 	Height      *int32
-	ContentType *string
+	ContentType *string // MIME type of the sniffed format, not the upstream header
 	ETag        *string
+	Format      string // sniffed image format, e.g. "png", "ico", "svg"
+	Data        []byte // icon bytes as downloaded (at most MaxIconBytes)
+
+	PageURL   string   // final URL of the scanned page, after redirects
+	Redirects []string // page redirect chain from the first request to PageURL; nil if none
+
+	Scheme       string // scheme the page was first requested over: "https", or "http" after fallback
+	MixedContent bool   // the icon was fetched over plain HTTP for an HTTPS page
 }
 
 var (
@@ -66,10 +78,18 @@ type Resolver struct {
 	Client        *http.Client
 	AllowLoopback bool
 	MaxHTMLBytes  int64
+	MaxIconBytes  int64        // max bytes to download for a single icon; defaults to 1 MiB
+	MaxRedirects  int          // redirect hops allowed per fetch; 0 means DefaultMaxRedirects
+	SchemePolicy  SchemePolicy // when plain HTTP may be used; empty means SchemeHTTPSOnly
+	RasterizeSVG  bool         // hand out SVG candidates rendered as PNG; ones that cannot be rendered are rejected
 }
 
-// SetClient overrides the HTTP client (useful for testing).
+// SetClient overrides the HTTP client (useful for testing). A client
+// without its own CheckRedirect gets the resolver's redirect policy.
 func (r *Resolver) SetClient(c *http.Client) {
+	if c.CheckRedirect == nil {
+		c.CheckRedirect = r.checkRedirect
+	}
 	r.Client = c
 }
 
@@ -86,23 +106,28 @@ func New(insecureSkipVerify bool, maxHTMLBytes int64, allowLoopback bool) *Resol
 		InsecureSkipVerify: insecureSkipVerify, //nolint:gosec // user-configured via ALLOW_INSECURE_TLS
 	}
 
-	client := &http.Client{
+	r := &Resolver{
+		AllowLoopback: allowLoopback,
+		MaxHTMLBytes:  maxHTMLBytes,
+		MaxIconBytes:  1 << 20, // 1 MiB
+	}
+	r.Client = &http.Client{
 		Timeout: 10 * time.Second,
 		Transport: &http.Transport{
+			// Every connection is checked against the SSRF rules at dial time
+			// (see newDialer). No proxy: it would hide the real destination.
+			DialContext:        r.newDialer().DialContext,
+			Proxy:              nil,
 			DisableKeepAlives:  true,
 			DisableCompression: false,
 			TLSClientConfig:    tlsCfg,
 		},
-		// We allow redirects (up to the Go default of 10) because many sites
-		// redirect from apex to www (e.g. google.com -> www.google.com)
-		// or HTTP to HTTPS before serving the HTML.
-	}
-
-	return &Resolver{
-		Client:        client,
-		AllowLoopback: allowLoopback,
-		MaxHTMLBytes:  maxHTMLBytes,
+		// We allow a few redirects because many sites redirect from apex to
+		// www (e.g. google.com -> www.google.com) or to a localized path
+		// before serving the HTML. Each hop is validated (see checkRedirect).
+		CheckRedirect: r.checkRedirect,
 	}
+	return r
 }
 
 func (r *Resolver) isPrivateIP(ip string) bool {
@@ -163,12 +188,23 @@ func (r *Resolver) validateURL(ctx context.Context, u *url.URL) error {
 	}
 	for _, ip := range ips {
 		if r.isPrivateIP(ip.String()) {
-			return errors.New("reserved/private IP not allowed")
+			return ErrBlockedAddress
 		}
 	}
 	return nil
 }
 
+// isGenericContentType reports whether ct is a catch-all type that many
+// servers send for favicon.ico. Such responses are accepted only if the
+// body sniffs as an image.
+func isGenericContentType(ct string) bool {
+	switch normalizeType(ct) {
+	case "application/octet-stream", "binary/octet-stream", "text/plain":
+		return true
+	}
+	return false
+}
+
 // isAllowedContentType checks if the Content-Type header represents a safe image type.
 func isAllowedContentType(ct string) bool {
 	ct = strings.TrimSpace(ct)
@@ -194,146 +230,452 @@ func isAllowedContentType(ct string) bool {
 	return false
 }
 
-// ResolveBestIcon fetches the target domain's HTML, parses <link> icon candidates,
-// probes each candidate via HEAD (with GET fallback), and returns the first valid icon URL.
+// ResolveBestIcon fetches the target domain's HTML, parses <link> icon candidates
+// and any Web App Manifest icons,
+// ranks them by declared size, type and rel (see scoreCandidate), downloads each
+// candidate in rank order, and returns the best one whose bytes decode as an image.
+// Failures are returned as *Error with a Reason (see ReasonOf).
 func (r *Resolver) ResolveBestIcon(ctx context.Context, target string) (src string, meta Meta, err error) {
-	destURL := "https://" + target
-	parsed, err := url.Parse(destURL)
+	candidates, page, err := r.fetchCandidates(ctx, target)
 	if err != nil {
 		return "", meta, err
 	}
-	if err := r.validateURL(ctx, parsed); err != nil {
-		return "", meta, err
+
+	for i := range candidates {
+		if m, ok := r.probeCandidate(ctx, &candidates[i], page); ok {
+			return m.SourceURL, m, nil
+		}
 	}
+	return "", meta, candidatesError(target, candidates, page)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", destURL, nil)
+// Revalidate re-runs ResolveBestIcon for a previously stored icon. When the
+// best candidate is still prevSrc, prevETag is sent as If-None-Match; if the
+// site answers 304, notModified is true and meta carries only SourceURL and
+// ETag. Otherwise the result is the same as ResolveBestIcon's.
+func (r *Resolver) Revalidate(ctx context.Context, target, prevSrc, prevETag string) (src string, meta Meta, notModified bool, err error) {
+	candidates, page, err := r.fetchCandidates(ctx, target)
 	if err != nil {
-		return "", meta, err
+		return "", meta, false, err
+	}
+
+	for i := range candidates {
+		if m, ok := r.probeCandidateIfNoneMatch(ctx, &candidates[i], page, prevSrc, prevETag); ok {
+			return m.SourceURL, m, m.Data == nil, nil
+		}
 	}
+	return "", meta, false, candidatesError(target, candidates, page)
+}
 
-	resp, err := r.Client.Do(req)
+// Report is the full outcome of inspecting a domain: every candidate found
+// on the page, in rank order, each with its probe result.
+type Report struct {
+	PageURL    string   // final page URL, after redirects
+	Redirects  []string // page redirect chain; nil if none
+	Scheme     string   // scheme the page was first requested over
+	Candidates []Candidate
+	Chosen     int // index into Candidates of the icon ResolveBestIcon would pick; -1 if none
+}
+
+// inspectConcurrency bounds parallel probes during Inspect.
+const inspectConcurrency = 4
+
+// Inspect performs the same page scan as ResolveBestIcon but probes every
+// candidate instead of stopping at the first valid one. It is meant for
+// debugging and metadata endpoints, not the hot path.
+func (r *Resolver) Inspect(ctx context.Context, target string) (Report, error) {
+	candidates, page, err := r.fetchCandidates(ctx, target)
 	if err != nil {
-		return "", meta, err
+		return Report{Chosen: -1}, err
+	}
+
+	sem := make(chan struct{}, inspectConcurrency)
+	var wg sync.WaitGroup
+	for i := range candidates {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(c *Candidate) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			r.probeCandidate(ctx, c, page)
+		}(&candidates[i])
+	}
+	wg.Wait()
+
+	rep := Report{PageURL: page.URL, Redirects: page.Redirects, Scheme: page.Scheme, Candidates: candidates, Chosen: -1}
+	for i, c := range candidates {
+		if c.Probe != nil && c.Probe.OK {
+			rep.Chosen = i
+			break
+		}
+	}
+	return rep, nil
+}
+
+// pageInfo describes where the home page fetch ended up.
+type pageInfo struct {
+	URL       string   // final URL, after redirects
+	Redirects []string // chain from the first request to URL; nil if none
+	Scheme    string   // scheme of the first request (see SchemePolicy)
+	final     string   // scheme of URL, which subresource upgrades are based on
+	truncated bool     // the HTML exceeded MaxHTMLBytes and was cut off
+}
+
+// fetchCandidates downloads the target's home page and returns its ranked
+// icon candidates together with the page they were resolved against.
+// Relative hrefs are resolved against the final URL after redirects, not
+// the URL originally requested. Errors are *Error.
+func (r *Resolver) fetchCandidates(ctx context.Context, target string) ([]Candidate, pageInfo, error) {
+	resp, scheme, err := r.fetchPage(ctx, target)
+	if err != nil {
+		return nil, pageInfo{}, pageError(target, err)
 	}
 	defer resp.Body.Close()
 
-	// Limit HTML body reading to prevent abuse from huge responses.
+	base := resp.Request.URL
+	pg := pageInfo{URL: base.String(), Redirects: redirectChain(resp), Scheme: scheme, final: base.Scheme}
+
+	// Limit HTML body reading to prevent abuse from huge responses. Pages
+	// over the limit are parsed up to it, since icons live in <head>.
 	// Note: goquery loads the entire limit into memory. A streaming HTML parser
 	// (like golang.org/x/net/html directly) would be more memory efficient for high
 	// throughput, but goquery is kept here for simplicity and readability.
-	limitedBody := io.LimitReader(resp.Body, r.MaxHTMLBytes)
-	doc, err := goquery.NewDocumentFromReader(limitedBody)
+	html, err := io.ReadAll(io.LimitReader(resp.Body, r.MaxHTMLBytes+1))
 	if err != nil {
-		return "", meta, err
+		return nil, pageInfo{}, pageError(target, err)
 	}
+	if int64(len(html)) > r.MaxHTMLBytes {
+		html, pg.truncated = html[:r.MaxHTMLBytes], true
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(html))
+	if err != nil {
+		return nil, pageInfo{}, pageError(target, err)
+	}
+
+	// <link> hrefs are relative to the document base: <base href> if
+	// present, else the response URL. /favicon.ico stays on the page's origin.
+	docBase := documentBase(doc, base)
+
+	set := newCandidateSet()
+	collectLinkCandidates(doc, docBase, set)
 
-	var candidates []string
-	doc.Find(`link[rel~="icon"], link[rel="apple-touch-icon"], link[rel="mask-icon"]`).Each(func(i int, s *goquery.Selection) {
-		if href, exists := s.Attr("href"); exists && href != "" {
-			candidates = append(candidates, href)
+	// Icons declared only in the Web App Manifest are merged best-effort;
+	// a broken or blocked manifest must not fail the whole resolve.
+	if href := manifestHref(doc); href != "" {
+		if u, err := url.Parse(href); err == nil {
+			if icons, err := r.fetchManifestIcons(ctx, docBase.ResolveReference(u), pg); err == nil {
+				for _, c := range icons {
+					set.add(c)
+				}
+			}
 		}
-	})
+	}
 
-	candidates = append(candidates, "/favicon.ico")
+	set.add(fallbackCandidate(base))
+
+	candidates := set.list
+	rankCandidates(candidates)
+	return candidates, pg, nil
+}
 
-	base, _ := url.Parse("https://" + target)
-	for _, c := range candidates {
-		u, err := url.Parse(c)
+// fetchPage GETs the target's home page over the schemes allowed by the
+// policy, in order. Plain HTTP is only tried when HTTPS could not be reached
+// at all; an HTTPS error status is returned as-is.
+func (r *Resolver) fetchPage(ctx context.Context, target string) (*http.Response, string, error) {
+	var firstErr error
+	for _, scheme := range r.pageSchemes() {
+		destURL := scheme + "://" + target
+		parsed, err := url.Parse(destURL)
 		if err != nil {
-			continue
+			return nil, "", err
+		}
+		if err := r.validateURL(ctx, parsed); err != nil {
+			return nil, "", err
 		}
-		abs := base.ResolveReference(u).String()
 
-		absParsed, err := url.Parse(abs)
+		req, err := http.NewRequestWithContext(ctx, "GET", destURL, nil)
 		if err != nil {
-			continue
-		}
-		if err := r.validateURL(ctx, absParsed); err != nil {
-			continue
+			return nil, "", err
 		}
 
-		// Try HEAD first; fall back to GET if HEAD is unsupported (405/401/403).
-		iconURL, m, ok := r.probeIcon(ctx, abs)
-		if !ok {
-			iconURL, m, ok = r.probeIconGet(ctx, abs)
+		resp, err := r.Client.Do(req)
+		if err == nil {
+			return resp, scheme, nil
+		}
+		if firstErr == nil {
+			firstErr = err
 		}
-		if ok {
-			return iconURL, m, nil
+		if ctx.Err() != nil || errors.Is(err, ErrBlockedAddress) {
+			break
 		}
 	}
-	return "", meta, errors.New("no icon found")
+	return nil, "", firstErr
 }
 
-// probeIcon sends a HEAD request to candidateURL. Returns (url, meta, true) on success.
-func (r *Resolver) probeIcon(ctx context.Context, candidateURL string) (string, Meta, bool) {
-	req, err := http.NewRequestWithContext(ctx, "HEAD", candidateURL, nil)
+// documentBase returns the base URL for resolving hrefs in doc, which was
+// served from pageURL: the first <base href> (itself resolved against
+// pageURL) when it is a valid http(s) URL, otherwise pageURL. Protocol-relative
+// hrefs ("//cdn.example/icon.png") then inherit the base's scheme.
+func documentBase(doc *goquery.Document, pageURL *url.URL) *url.URL {
+	href, ok := doc.Find("base[href]").First().Attr("href")
+	if !ok {
+		return pageURL
+	}
+	u, err := url.Parse(strings.TrimSpace(href))
 	if err != nil {
-		return "", Meta{}, false
+		return pageURL
 	}
-	req.Header.Set("User-Agent", "Favget/1.0")
+	b := pageURL.ResolveReference(u)
+	if !isValidScheme(b.Scheme) || b.Host == "" {
+		return pageURL
+	}
+	return b
+}
 
-	h, err := r.Client.Do(req)
-	if err != nil {
-		return "", Meta{}, false
+// candidateSet accumulates candidates in discovery order, dropping
+// duplicate absolute URLs (first occurrence wins).
+type candidateSet struct {
+	list []Candidate
+	seen map[string]bool
+}
+
+func newCandidateSet() *candidateSet {
+	return &candidateSet{seen: map[string]bool{}}
+}
+
+func (cs *candidateSet) add(c Candidate) {
+	if c.URL == "" || cs.seen[c.URL] {
+		return
 	}
-	h.Body.Close()
+	cs.seen[c.URL] = true
+	cs.list = append(cs.list, c)
+}
 
-	if h.StatusCode < 200 || h.StatusCode >= 400 {
-		return "", Meta{}, false
+// collectLinkCandidates scans <link> icon elements in document order and
+// resolves each href against base.
+func collectLinkCandidates(doc *goquery.Document, base *url.URL, set *candidateSet) {
+	doc.Find(`link[rel]`).Each(func(i int, s *goquery.Selection) {
+		href := strings.TrimSpace(s.AttrOr("href", ""))
+		if href == "" {
+			return
+		}
+		rel := parseRel(s.AttrOr("rel", ""))
+		if rel == "" {
+			return
+		}
+		abs, ok := resolveHref(base, href)
+		if !ok {
+			return
+		}
+		set.add(Candidate{
+			Href:  href,
+			URL:   abs,
+			Rel:   rel,
+			Sizes: parseSizes(s.AttrOr("sizes", "")),
+			Type:  normalizeType(s.AttrOr("type", "")),
+		})
+	})
+}
+
+// resolveHref resolves href against base. data: URIs are kept verbatim:
+// their payload may contain characters ('#', spaces) that url.Parse would
+// split off or reject.
+func resolveHref(base *url.URL, href string) (string, bool) {
+	if isDataURI(href) {
+		return href, true
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", false
 	}
+	return base.ResolveReference(u).String(), true
+}
 
-	ct := h.Header.Get("Content-Type")
-	if ct != "" && !isAllowedContentType(ct) {
-		return "", Meta{}, false
+// fallbackCandidate is the implicit /favicon.ico every browser tries.
+func fallbackCandidate(base *url.URL) Candidate {
+	return Candidate{
+		Href: "/favicon.ico",
+		URL:  base.ResolveReference(&url.URL{Path: "/favicon.ico"}).String(),
+		Rel:  RelFallback,
 	}
+}
+
+// Probe records the outcome of probing one candidate URL.
+type Probe struct {
+	OK          bool
+	URL         string // URL actually fetched; differs from Candidate.URL when upgraded to HTTPS
+	Status      int    // HTTP status code; 0 if no response was received
+	ContentType string // Content-Type header as sent by the server
+	ETag        string
+	Format      string // format sniffed from the body, e.g. "png"; empty if unrecognised
+	Width       int    // decoded pixel width; 0 if unknown
+	Height      int    // decoded pixel height; 0 if unknown
+	Reason      Reason // machine-readable cause of Err; empty when OK
+	Err         string // why the candidate was rejected; empty when OK
+}
 
-	etag := h.Header.Get("ETag")
-	meta := Meta{SourceURL: candidateURL}
-	if ct != "" {
-		meta.ContentType = &ct
+// fail records a rejection on p.
+func (p *Probe) fail(reason Reason, msg string) {
+	p.OK, p.Reason, p.Err = false, reason, msg
+}
+
+// probeCandidate validates c.URL against the SSRF rules, then downloads and
+// decodes it, trying the URLs allowed by the scheme policy in turn (see
+// schemeAttempts). The outcome of the last attempt is stored in c.Probe.
+func (r *Resolver) probeCandidate(ctx context.Context, c *Candidate, page pageInfo) (Meta, bool) {
+	return r.probeCandidateIfNoneMatch(ctx, c, page, "", "")
+}
+
+// probeCandidateIfNoneMatch is probeCandidate with a conditional GET: when
+// the URL being fetched is prevSrc, prevETag is sent as If-None-Match, and a
+// 304 counts as success and yields a Meta without Data.
+func (r *Resolver) probeCandidateIfNoneMatch(ctx context.Context, c *Candidate, page pageInfo, prevSrc, prevETag string) (Meta, bool) {
+	if isDataURI(c.URL) {
+		m, p := r.decodeDataCandidate(c.URL)
+		c.Probe = &p
+		if p.OK {
+			m.PageURL, m.Redirects, m.Scheme = page.URL, page.Redirects, page.Scheme
+		}
+		return m, p.OK
 	}
-	if etag != "" {
-		meta.ETag = &etag
+	attempts := r.schemeAttempts(c.URL, page.final)
+	if len(attempts) == 0 {
+		c.Probe = &Probe{URL: c.URL, Reason: ReasonInsecureScheme, Err: ErrInsecureScheme.Error()}
+		return Meta{}, false
 	}
-	return candidateURL, meta, true
+	for _, target := range attempts {
+		u, err := url.Parse(target)
+		if err != nil {
+			c.Probe = &Probe{URL: target, Reason: ReasonInvalidURL, Err: "invalid URL"}
+			continue
+		}
+		if err := r.validateURL(ctx, u); err != nil {
+			c.Probe = &Probe{URL: target, Reason: classify(err), Err: err.Error()}
+			continue
+		}
+
+		etag := ""
+		if target == prevSrc {
+			etag = prevETag
+		}
+		m, p := r.fetchIcon(ctx, target, etag)
+		p.URL = target
+		c.Probe = &p
+		if p.OK {
+			m.PageURL, m.Redirects, m.Scheme = page.URL, page.Redirects, page.Scheme
+			m.MixedContent = page.final == "https" && u.Scheme == "http"
+			return m, true
+		}
+	}
+	return Meta{}, false
 }
 
-// probeIconGet sends a GET request with a small body read to verify the icon exists
-// and validate content type. Used when HEAD is not supported.
-func (r *Resolver) probeIconGet(ctx context.Context, candidateURL string) (string, Meta, bool) {
-	req, err := http.NewRequestWithContext(ctx, "GET", candidateURL, nil)
+// fetchIcon GETs candidateURL, reads at most MaxIconBytes, and verifies the
+// body is a real image by sniffing its magic bytes and decoding its header.
+// The Content-Type header is only used to reject obviously wrong responses;
+// the format and dimensions in Meta always come from the bytes. A non-empty
+// etag is sent as If-None-Match.
+func (r *Resolver) fetchIcon(ctx context.Context, candidateURL, etag string) (Meta, Probe) {
+	var p Probe
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, candidateURL, nil)
 	if err != nil {
-		return "", Meta{}, false
+		p.fail(ReasonInvalidURL, err.Error())
+		return Meta{}, p
 	}
 	req.Header.Set("User-Agent", "Favget/1.0")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
 
 	h, err := r.Client.Do(req)
 	if err != nil {
-		return "", Meta{}, false
+		p.fail(classify(err), err.Error())
+		return Meta{}, p
 	}
 	defer h.Body.Close()
 
+	p.Status = h.StatusCode
+	p.ContentType = h.Header.Get("Content-Type")
+	p.ETag = h.Header.Get("ETag")
+
+	if etag != "" && h.StatusCode == http.StatusNotModified {
+		p.OK = true
+		return Meta{SourceURL: candidateURL, ETag: &etag}, p
+	}
+
 	if h.StatusCode < 200 || h.StatusCode >= 400 {
-		return "", Meta{}, false
+		p.fail(ReasonHTTPStatus, "unexpected status")
+		return Meta{}, p
+	}
+	if p.ContentType != "" && !isAllowedContentType(p.ContentType) && !isGenericContentType(p.ContentType) {
+		p.fail(ReasonContentType, "content type not allowed")
+		return Meta{}, p
+	}
+	if h.ContentLength > r.MaxIconBytes {
+		p.fail(ReasonTooLarge, "icon too large")
+		return Meta{}, p
 	}
 
-	ct := h.Header.Get("Content-Type")
-	if ct != "" && !isAllowedContentType(ct) {
-		return "", Meta{}, false
+	data, err := io.ReadAll(io.LimitReader(h.Body, r.MaxIconBytes+1))
+	if err != nil {
+		p.fail(classify(err), err.Error())
+		return Meta{}, p
+	}
+	if int64(len(data)) > r.MaxIconBytes {
+		p.fail(ReasonTooLarge, "icon too large")
+		return Meta{}, p
+	}
+
+	meta, ok := r.decodeIcon(candidateURL, data, &p)
+	if ok && p.ETag != "" {
+		etag := p.ETag
+		meta.ETag = &etag
 	}
+	return meta, p
+}
 
-	// Read a small amount to verify content and detect content sniffing issues.
-	buf := make([]byte, 512)
-	n, _ := io.ReadFull(h.Body, buf)
-	_ = buf[:n] // content read but not used further; we trust the Content-Type header
+// decodeIcon sniffs and decodes downloaded icon bytes, recording the result
+// in p. The format and dimensions in Meta always come from the bytes handed
+// out; p describes the candidate as found upstream.
+func (r *Resolver) decodeIcon(sourceURL string, data []byte, p *Probe) (Meta, bool) {
+	info, err := imagex.Decode(data)
+	if err != nil {
+		p.fail(ReasonUndecodable, err.Error())
+		return Meta{}, false
+	}
+	p.Format = string(info.Format)
+	p.Width, p.Height = info.Width, info.Height
+	if info.Format == imagex.FormatSVG {
+		// SVGs can carry scripts and external references; only sanitized
+		// markup ever leaves the resolver.
+		if data, err = imagex.SanitizeSVG(data); err != nil {
+			p.fail(ReasonUnsafeSVG, err.Error())
+			return Meta{}, false
+		}
+		if r.RasterizeSVG {
+			// No markup at all: the PNG rendering replaces the SVG, and an SVG
+			// that cannot be rendered is skipped like an undecodable image.
+			if data, err = imagex.Render(data, 0, imagex.FormatPNG); err == nil {
+				info, err = imagex.Decode(data)
+			}
+			if err != nil {
+				p.fail(ReasonUndecodable, "svg cannot be rasterized: "+err.Error())
+				return Meta{}, false
+			}
+		}
+	}
+	p.OK = true
 
-	etag := h.Header.Get("ETag")
-	meta := Meta{SourceURL: candidateURL}
-	if ct != "" {
-		meta.ContentType = &ct
+	ct := info.Format.MIME()
+	meta := Meta{
+		SourceURL:   sourceURL,
+		ContentType: &ct,
+		Format:      string(info.Format),
+		Data:        data,
 	}
-	if etag != "" {
-		meta.ETag = &etag
+	if info.Width > 0 && info.Height > 0 {
+		w, hh := int32(info.Width), int32(info.Height)
+		meta.Width, meta.Height = &w, &hh
 	}
-	return candidateURL, meta, true
+	return meta, true
 }
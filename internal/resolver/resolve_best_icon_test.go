@@ -1,8 +1,12 @@
 package resolver_test
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/binary"
+	"image"
+	"image/png"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -13,6 +17,29 @@ import (
 	"github.com/kudanilll/favget/internal/resolver"
 )
 
+const testSVG = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 64 64"><circle cx="32" cy="32" r="30"/></svg>`
+
+// testPNG encodes a blank w×h PNG.
+func testPNG(w, h int) []byte {
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, w, h)))
+	return buf.Bytes()
+}
+
+// testICO wraps a size×size PNG in a single-entry ICO container.
+func testICO(size int) []byte {
+	img := testPNG(size, size)
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, [3]uint16{0, 1, 1})
+	_ = binary.Write(&buf, binary.LittleEndian, struct {
+		W, H, Colors, Reserved uint8
+		Planes, BitCount       uint16
+		Size, Offset           uint32
+	}{uint8(size), uint8(size), 0, 0, 1, 32, uint32(len(img)), 22})
+	buf.Write(img)
+	return buf.Bytes()
+}
+
 // startTLSSite spins up a fresh HTTPS test server for each scenario
 // and returns a custom HTTP client that routes all requests to this server.
 //
@@ -71,11 +98,12 @@ func TestResolveBestIcon(t *testing.T) {
 			"/fav.png": func(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusOK)
 				if r.Method != http.MethodHead {
-					_, _ = w.Write([]byte("PNG"))
+					_, _ = w.Write(testPNG(32, 32))
 				}
 			},
 			"/favicon.ico": func(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write(testICO(16))
 			},
 		}
 		domain, client, cleanup := startTLSSite(t, home, extra)
@@ -100,7 +128,7 @@ func TestResolveBestIcon(t *testing.T) {
 			"/favicon.ico": func(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusOK)
 				if r.Method != http.MethodHead {
-					_, _ = w.Write([]byte("ICO"))
+					_, _ = w.Write(testICO(16))
 				}
 			},
 		}
@@ -130,7 +158,7 @@ func TestResolveBestIcon(t *testing.T) {
 				}
 				w.Header().Set("Content-Type", "image/x-icon")
 				w.WriteHeader(http.StatusOK)
-				_, _ = w.Write([]byte("ICO"))
+				_, _ = w.Write(testICO(16))
 			},
 		}
 		domain, client, cleanup := startTLSSite(t, home, extra)
@@ -159,7 +187,7 @@ func TestResolveBestIcon(t *testing.T) {
 			"/favicon.ico": func(w http.ResponseWriter, r *http.Request) {
 				w.Header().Set("Content-Type", "image/x-icon")
 				w.WriteHeader(http.StatusOK)
-				_, _ = w.Write([]byte("ICO"))
+				_, _ = w.Write(testICO(16))
 			},
 		}
 		domain, client, cleanup := startTLSSite(t, home, extra)
@@ -176,4 +204,173 @@ func TestResolveBestIcon(t *testing.T) {
 			t.Fatalf("got %q, want fallback /favicon.ico after content type rejection", src)
 		}
 	}
+	// --- Case 5: larger declared PNG outranks a small ICO listed first ---
+	{
+		home := `<!doctype html><head>
+<link rel="icon" href="/small.ico" sizes="16x16">
+<link rel="icon" type="image/png" href="/large.png" sizes="512x512">
+<link rel="mask-icon" href="/mask.svg">
+</head>`
+		ok := func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(testPNG(32, 32))
+		}
+		extra := map[string]http.HandlerFunc{
+			"/small.ico": ok,
+			"/large.png": ok,
+			"/mask.svg":  ok,
+		}
+		domain, client, cleanup := startTLSSite(t, home, extra)
+		defer cleanup()
+
+		r := resolver.New(true, 1<<20, true)
+		r.SetClient(client)
+
+		src, _, err := r.ResolveBestIcon(context.Background(), domain)
+		if err != nil {
+			t.Fatalf("ResolveBestIcon(%q) error: %v", domain, err)
+		}
+		if !strings.HasSuffix(src, "/large.png") {
+			t.Fatalf("got %q, want /large.png ranked above 16x16 ico", src)
+		}
+	}
+
+	// --- Case 6: SVG icon outranks rasters; mask-icon is never preferred ---
+	{
+		home := `<!doctype html><head>
+<link rel="mask-icon" href="/mask.svg" color="#000">
+<link rel="apple-touch-icon" href="/apple.png">
+<link rel="icon" type="image/svg+xml" href="/icon.svg">
+</head>`
+		ok := func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, ".svg") {
+				_, _ = w.Write([]byte(testSVG))
+				return
+			}
+			_, _ = w.Write(testPNG(180, 180))
+		}
+		extra := map[string]http.HandlerFunc{
+			"/mask.svg":  ok,
+			"/apple.png": ok,
+			"/icon.svg":  ok,
+		}
+		domain, client, cleanup := startTLSSite(t, home, extra)
+		defer cleanup()
+
+		r := resolver.New(true, 1<<20, true)
+		r.SetClient(client)
+
+		src, _, err := r.ResolveBestIcon(context.Background(), domain)
+		if err != nil {
+			t.Fatalf("ResolveBestIcon(%q) error: %v", domain, err)
+		}
+		if !strings.HasSuffix(src, "/icon.svg") {
+			t.Fatalf("got %q, want /icon.svg", src)
+		}
+	}
+	// --- Case 7: high-resolution icon declared only in the Web App Manifest ---
+	{
+		home := `<!doctype html><head>
+<link rel="icon" href="/small.png" sizes="32x32">
+<link rel="manifest" href="/app/site.webmanifest">
+</head>`
+		ok := func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(testPNG(32, 32))
+		}
+		extra := map[string]http.HandlerFunc{
+			"/app/site.webmanifest": func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/manifest+json")
+				_, _ = w.Write([]byte(`{"icons":[
+					{"src":"mono-1024.png","sizes":"1024x1024","type":"image/png","purpose":"monochrome"},
+					{"src":"icon-512.png","sizes":"512x512","type":"image/png","purpose":"any maskable"}
+				]}`))
+			},
+			"/small.png":         ok,
+			"/app/mono-1024.png": ok,
+			"/app/icon-512.png":  ok,
+		}
+		domain, client, cleanup := startTLSSite(t, home, extra)
+		defer cleanup()
+
+		r := resolver.New(true, 1<<20, true)
+		r.SetClient(client)
+
+		src, _, err := r.ResolveBestIcon(context.Background(), domain)
+		if err != nil {
+			t.Fatalf("ResolveBestIcon(%q) error: %v", domain, err)
+		}
+		if !strings.HasSuffix(src, "/app/icon-512.png") {
+			t.Fatalf("got %q, want manifest /app/icon-512.png", src)
+		}
+	}
+	// --- Case 8: HTML error page served as image/png is rejected; dimensions come from bytes ---
+	{
+		home := `<!doctype html><head>
+<link rel="icon" type="image/png" href="/soft404.png" sizes="512x512">
+<link rel="icon" type="image/png" href="/real.png" sizes="64x64">
+</head>`
+		extra := map[string]http.HandlerFunc{
+			"/soft404.png": func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				_, _ = w.Write([]byte("<!doctype html><title>Not found</title>"))
+			},
+			"/real.png": func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				_, _ = w.Write(testPNG(48, 40))
+			},
+		}
+		domain, client, cleanup := startTLSSite(t, home, extra)
+		defer cleanup()
+
+		r := resolver.New(true, 1<<20, true)
+		r.SetClient(client)
+
+		src, meta, err := r.ResolveBestIcon(context.Background(), domain)
+		if err != nil {
+			t.Fatalf("ResolveBestIcon(%q) error: %v", domain, err)
+		}
+		if !strings.HasSuffix(src, "/real.png") {
+			t.Fatalf("got %q, want /real.png after rejecting HTML body", src)
+		}
+		if meta.Width == nil || meta.Height == nil || *meta.Width != 48 || *meta.Height != 40 {
+			t.Fatalf("meta dimensions = %v x %v, want 48 x 40", meta.Width, meta.Height)
+		}
+		if meta.Format != "png" {
+			t.Fatalf("meta.Format = %q, want png", meta.Format)
+		}
+	}
+	// --- Case 9: SVG icons are sanitized; ones that cannot be are skipped ---
+	{
+		home := `<!doctype html><head>
+<link rel="icon" type="image/svg+xml" href="/bomb.svg">
+<link rel="icon" type="image/svg+xml" href="/xss.svg" sizes="any">
+</head>`
+		extra := map[string]http.HandlerFunc{
+			"/bomb.svg": func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`<!DOCTYPE svg [<!ENTITY a "aaaa">]><svg xmlns="http://www.w3.org/2000/svg"><text>&a;</text></svg>`))
+			},
+			"/xss.svg": func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 64 64" onload="alert(1)"><script>alert(2)</script><circle r="30"/></svg>`))
+			},
+		}
+		domain, client, cleanup := startTLSSite(t, home, extra)
+		defer cleanup()
+
+		r := resolver.New(true, 1<<20, true)
+		r.SetClient(client)
+
+		src, meta, err := r.ResolveBestIcon(context.Background(), domain)
+		if err != nil {
+			t.Fatalf("ResolveBestIcon(%q) error: %v", domain, err)
+		}
+		if !strings.HasSuffix(src, "/xss.svg") {
+			t.Fatalf("got %q, want /xss.svg", src)
+		}
+		if body := string(meta.Data); strings.Contains(body, "alert") || !strings.Contains(body, "<circle") {
+			t.Fatalf("meta.Data not sanitized: %s", body)
+		}
+	}
 }
@@ -0,0 +1,70 @@
+package resolver_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/kudanilll/favget/internal/resolver"
+)
+
+// TestRevalidate checks that the stored ETag is sent only for the previously
+// chosen icon, that a 304 is reported as not modified, and that a new best
+// candidate or a changed ETag yields fresh bytes.
+func TestRevalidate(t *testing.T) {
+	home := `<!doctype html><head><link rel="icon" href="/icon.png" sizes="32x32"></head>`
+	extra := map[string]http.HandlerFunc{
+		"/icon.png": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"v2"`)
+			if r.Header.Get("If-None-Match") == `"v2"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(testPNG(32, 32))
+		},
+		"/favicon.ico": func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("If-None-Match") != "" {
+				t.Errorf("If-None-Match sent for a candidate that was not stored")
+			}
+			w.Header().Set("Content-Type", "image/x-icon")
+			_, _ = w.Write(testICO(16))
+		},
+	}
+	domain, client, cleanup := startTLSSite(t, home, extra)
+	defer cleanup()
+
+	r := resolver.New(true, 1<<20, true)
+	r.SetClient(client)
+	iconURL := "https://" + domain + "/icon.png"
+
+	tests := []struct {
+		name            string
+		prevSrc         string
+		prevETag        string
+		wantNotModified bool
+	}{
+		{"same-etag", iconURL, `"v2"`, true},
+		{"changed-etag", iconURL, `"v1"`, false},
+		{"no-etag", iconURL, "", false},
+		{"new-best-candidate", "https://" + domain + "/favicon.ico", `"v2"`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, meta, notModified, err := r.Revalidate(context.Background(), domain, tt.prevSrc, tt.prevETag)
+			if err != nil {
+				t.Fatalf("Revalidate error: %v", err)
+			}
+			if src != iconURL {
+				t.Fatalf("src = %q, want %q", src, iconURL)
+			}
+			if notModified != tt.wantNotModified {
+				t.Fatalf("notModified = %v, want %v", notModified, tt.wantNotModified)
+			}
+			if !notModified && (len(meta.Data) == 0 || meta.ETag == nil || *meta.ETag != `"v2"`) {
+				t.Fatalf("meta = %+v, want fresh bytes with ETag \"v2\"", meta)
+			}
+		})
+	}
+}
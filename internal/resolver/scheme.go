@@ -0,0 +1,74 @@
+package resolver
+
+import (
+	"errors"
+	"net/url"
+)
+
+// SchemePolicy controls when plain HTTP may be used.
+type SchemePolicy string
+
+const (
+	// SchemeHTTPSOnly fetches pages, redirects and icons over HTTPS only.
+	// HTTP icon links are upgraded to HTTPS. This is the default.
+	SchemeHTTPSOnly SchemePolicy = "https-only"
+	// SchemeHTTPSThenHTTP fetches the page over HTTPS and retries over HTTP
+	// when HTTPS is unreachable. Plain HTTP is then allowed for that page's
+	// redirects and icons; pages served over HTTPS still get HTTPS icons.
+	SchemeHTTPSThenHTTP SchemePolicy = "https-then-http"
+	// SchemeHTTPAllowed is SchemeHTTPSThenHTTP, and additionally lets HTTPS
+	// pages use HTTP-only icons (after trying the HTTPS upgrade first).
+	SchemeHTTPAllowed SchemePolicy = "http-allowed"
+)
+
+// ErrInsecureScheme is returned (wrapped) when the scheme policy forbids a
+// plain HTTP request.
+var ErrInsecureScheme = errors.New("plain HTTP not allowed by scheme policy")
+
+func (r *Resolver) schemePolicy() SchemePolicy {
+	if r.SchemePolicy == "" {
+		return SchemeHTTPSOnly
+	}
+	return r.SchemePolicy
+}
+
+// pageSchemes returns the schemes to try, in order, for the home page.
+func (r *Resolver) pageSchemes() []string {
+	if r.schemePolicy() == SchemeHTTPSOnly {
+		return []string{"https"}
+	}
+	return []string{"https", "http"}
+}
+
+// allowHTTP reports whether plain HTTP requests may be made on behalf of a
+// page whose fetch started with startScheme.
+func (r *Resolver) allowHTTP(startScheme string) bool {
+	switch r.schemePolicy() {
+	case SchemeHTTPAllowed:
+		return true
+	case SchemeHTTPSThenHTTP:
+		return startScheme == "http"
+	}
+	return false
+}
+
+// schemeAttempts returns the URLs to try for a subresource (icon, manifest)
+// linked from a page served over pageScheme. HTTPS URLs are used as-is. HTTP
+// URLs on an HTTPS page are upgraded first, as browsers do for mixed content,
+// and then tried as-is if the policy allows plain HTTP for the page.
+func (r *Resolver) schemeAttempts(rawURL, pageScheme string) []string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "http" {
+		return []string{rawURL}
+	}
+	var out []string
+	if pageScheme == "https" {
+		up := *u
+		up.Scheme = "https"
+		out = append(out, up.String())
+	}
+	if r.allowHTTP(pageScheme) {
+		out = append(out, rawURL)
+	}
+	return out
+}
@@ -0,0 +1,105 @@
+package resolver_test
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/kudanilll/favget/internal/resolver"
+)
+
+// TestSchemePolicy runs each policy against two sites: 127.0.0.2 serves only
+// plain HTTP, and 127.0.0.1 serves its page over HTTPS but links an icon that
+// exists only over HTTP (with /favicon.ico available over HTTPS).
+func TestSchemePolicy(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = w.Write([]byte(`<link rel="icon" href="/icon.png" sizes="32x32">`))
+		case "/icon.png", "/only-http.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(testPNG(32, 32))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer plain.Close()
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = w.Write([]byte(`<link rel="icon" href="http://127.0.0.1/only-http.png" sizes="64x64">`))
+		case "/favicon.ico":
+			w.Header().Set("Content-Type", "image/x-icon")
+			_, _ = w.Write(testICO(16))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer secure.Close()
+
+	// Port 443 on 127.0.0.1 reaches the TLS server; port 80 on either host
+	// reaches the plain server; anything else is refused.
+	route := map[string]string{
+		"127.0.0.1:443": strings.TrimPrefix(secure.URL, "https://"),
+		"127.0.0.1:80":  strings.TrimPrefix(plain.URL, "http://"),
+		"127.0.0.2:80":  strings.TrimPrefix(plain.URL, "http://"),
+	}
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec // test cert only
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			to, ok := route[addr]
+			if !ok {
+				return nil, &net.OpError{Op: "dial", Net: network, Err: syscall.ECONNREFUSED}
+			}
+			var d net.Dialer
+			return d.DialContext(ctx, network, to)
+		},
+	}}
+
+	tests := []struct {
+		policy     resolver.SchemePolicy
+		target     string
+		wantErr    bool
+		wantSrc    string
+		wantScheme string
+		wantMixed  bool
+	}{
+		{resolver.SchemeHTTPSOnly, "127.0.0.2", true, "", "", false},
+		{resolver.SchemeHTTPSThenHTTP, "127.0.0.2", false, "http://127.0.0.2/icon.png", "http", false},
+		{resolver.SchemeHTTPAllowed, "127.0.0.2", false, "http://127.0.0.2/icon.png", "http", false},
+		// The HTTP-only icon is tried as https first; only http-allowed falls back to it.
+		{resolver.SchemeHTTPSOnly, "127.0.0.1", false, "https://127.0.0.1/favicon.ico", "https", false},
+		{resolver.SchemeHTTPSThenHTTP, "127.0.0.1", false, "https://127.0.0.1/favicon.ico", "https", false},
+		{resolver.SchemeHTTPAllowed, "127.0.0.1", false, "http://127.0.0.1/only-http.png", "https", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy)+"/"+tt.target, func(t *testing.T) {
+			r := resolver.New(true, 1<<20, true)
+			r.SchemePolicy = tt.policy
+			r.SetClient(&http.Client{Transport: client.Transport})
+
+			src, meta, err := r.ResolveBestIcon(context.Background(), tt.target)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ResolveBestIcon succeeded with %q, want error", src)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveBestIcon error: %v", err)
+			}
+			if src != tt.wantSrc || meta.SourceURL != tt.wantSrc {
+				t.Fatalf("src = %q (meta %q), want %q", src, meta.SourceURL, tt.wantSrc)
+			}
+			if meta.Scheme != tt.wantScheme || meta.MixedContent != tt.wantMixed {
+				t.Fatalf("Scheme = %q, MixedContent = %v; want %q, %v", meta.Scheme, meta.MixedContent, tt.wantScheme, tt.wantMixed)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package resolver
+
+import (
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Rel values recognised on icon <link> elements. "shortcut icon" and other
+// multi-token forms are collapsed to RelIcon.
+const (
+	RelIcon           = "icon"
+	RelAppleTouchIcon = "apple-touch-icon"
+	RelMaskIcon       = "mask-icon"
+	RelManifest       = "manifest" // icon listed in the Web App Manifest
+	RelFallback       = "fallback" // implicit /favicon.ico, not declared by the page
+)
+
+// Size is a declared icon dimension from a `sizes` attribute.
+// A zero Size with Any=true represents `sizes="any"` (scalable).
+type Size struct {
+	Width  int
+	Height int
+	Any    bool
+}
+
+// Candidate is an icon reference discovered while scanning a page.
+type Candidate struct {
+	Href    string   // href (or manifest src) exactly as written
+	URL     string   // absolute URL resolved against the page or manifest base
+	Rel     string   // one of the Rel* constants
+	Sizes   []Size   // parsed `sizes`; empty when not declared
+	Type    string   // declared MIME type, lower-cased without parameters
+	Purpose []string // manifest `purpose` keywords; empty means "any"
+	Score   int      // ranking score; higher is better
+	Probe   *Probe   // probe outcome; nil if the candidate was not probed
+}
+
+// String formats s as it would appear in a `sizes` attribute.
+func (s Size) String() string {
+	if s.Any {
+		return "any"
+	}
+	return strconv.Itoa(s.Width) + "x" + strconv.Itoa(s.Height)
+}
+
+// parseSizes parses a `sizes` attribute such as "16x16 32x32" or "any".
+// Malformed tokens are ignored.
+func parseSizes(raw string) []Size {
+	var out []Size
+	for _, tok := range strings.Fields(strings.ToLower(raw)) {
+		if tok == "any" {
+			out = append(out, Size{Any: true})
+			continue
+		}
+		w, h, ok := strings.Cut(tok, "x")
+		if !ok {
+			continue
+		}
+		wi, err1 := strconv.Atoi(w)
+		hi, err2 := strconv.Atoi(h)
+		if err1 != nil || err2 != nil || wi <= 0 || hi <= 0 {
+			continue
+		}
+		out = append(out, Size{Width: wi, Height: hi})
+	}
+	return out
+}
+
+// parseRel maps a space-separated rel attribute to one of the Rel* constants.
+// Returns "" if the rel does not describe an icon.
+func parseRel(raw string) string {
+	var isIcon bool
+	for _, tok := range strings.Fields(strings.ToLower(raw)) {
+		switch tok {
+		case RelAppleTouchIcon, "apple-touch-icon-precomposed":
+			return RelAppleTouchIcon
+		case RelMaskIcon:
+			return RelMaskIcon
+		case RelIcon:
+			isIcon = true
+		}
+	}
+	if isIcon {
+		return RelIcon
+	}
+	return ""
+}
+
+// normalizeType strips parameters and lower-cases a MIME type.
+func normalizeType(t string) string {
+	if i := strings.IndexByte(t, ';'); i != -1 {
+		t = t[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(t))
+}
+
+// format guesses the image format from the declared type, falling back to the
+// href extension. Returns "svg", "png", "ico", "jpeg", "webp", "gif" or "".
+func (c Candidate) format() string {
+	t := c.Type
+	if t == "" && isDataURI(c.URL) {
+		t = dataURIMediaType(c.URL)
+	}
+	switch t {
+	case "image/svg+xml":
+		return "svg"
+	case "image/png", "image/apng":
+		return "png"
+	case "image/x-icon", "image/vnd.microsoft.icon":
+		return "ico"
+	case "image/jpeg":
+		return "jpeg"
+	case "image/webp":
+		return "webp"
+	case "image/gif":
+		return "gif"
+	}
+	p := c.Href
+	if i := strings.IndexAny(p, "?#"); i != -1 {
+		p = p[:i]
+	}
+	switch strings.ToLower(path.Ext(p)) {
+	case ".svg":
+		return "svg"
+	case ".png":
+		return "png"
+	case ".ico":
+		return "ico"
+	case ".jpg", ".jpeg":
+		return "jpeg"
+	case ".webp":
+		return "webp"
+	case ".gif":
+		return "gif"
+	}
+	return ""
+}
+
+// largestSize returns the largest declared edge in pixels, or 0 if none.
+func (c Candidate) largestSize() int {
+	best := 0
+	for _, s := range c.Sizes {
+		if m := min(s.Width, s.Height); m > best {
+			best = m
+		}
+	}
+	return best
+}
+
+// hasPurpose reports whether c declares purpose p. Icons without a purpose
+// are treated as "any".
+func (c Candidate) hasPurpose(p string) bool {
+	if len(c.Purpose) == 0 {
+		return p == PurposeAny
+	}
+	for _, v := range c.Purpose {
+		if v == p {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Candidate) isScalable() bool {
+	if c.format() == "svg" {
+		return true
+	}
+	for _, s := range c.Sizes {
+		if s.Any {
+			return true
+		}
+	}
+	return false
+}
+
+// Score weights. Sizes are capped so an oversized raster cannot outrank SVG.
+const (
+	scoreScalable  = 10000
+	scoreMaxPixels = 1024
+	scorePerPixel  = 8
+)
+
+// scoreCandidate ranks a candidate by expected visual quality:
+// scalable icons first, then rasters by declared size with a small bonus
+// for lossless formats. mask-icon and monochrome manifest icons are
+// silhouettes and the implicit /favicon.ico is a guess, so they rank last.
+// Maskable-only manifest icons carry safe-zone padding, so their artwork is
+// scored at 80% of the declared size.
+func scoreCandidate(c Candidate) int {
+	switch {
+	case c.Rel == RelMaskIcon:
+		return 0
+	case c.Rel == RelFallback:
+		return 1
+	case c.Rel == RelManifest && !c.hasPurpose(PurposeAny) && !c.hasPurpose(PurposeMaskable):
+		return 0 // monochrome only
+	}
+	maskable := c.Rel == RelManifest && !c.hasPurpose(PurposeAny)
+	if c.isScalable() {
+		if maskable {
+			return scoreScalable - 1
+		}
+		return scoreScalable
+	}
+
+	px := c.largestSize()
+	if px == 0 {
+		// Undeclared sizes: apple-touch-icon is 180px by convention,
+		// a plain icon is most often a 16/32px favicon.
+		if c.Rel == RelAppleTouchIcon {
+			px = 180
+		} else {
+			px = 16
+		}
+	}
+	px = min(px, scoreMaxPixels)
+	if maskable {
+		px = px * 4 / 5
+	}
+
+	score := 10 + px*scorePerPixel
+	switch c.format() {
+	case "png", "webp":
+		score += 4
+	case "ico", "gif":
+		score += 2
+	}
+	return score
+}
+
+// rankCandidates scores candidates and sorts them best-first.
+// Ties keep document order.
+func rankCandidates(cs []Candidate) {
+	for i := range cs {
+		cs[i].Score = scoreCandidate(cs[i])
+	}
+	sort.SliceStable(cs, func(i, j int) bool {
+		return cs[i].Score > cs[j].Score
+	})
+}
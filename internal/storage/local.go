@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	imagex "github.com/kudanilll/favget/internal/image"
+)
+
+// Local stores objects as files under Root. Objects are served by Favget
+// itself (see httpx.Server.handleObject) unless PublicBaseURL points at
+// another server exposing the same directory.
+type Local struct {
+	Root          string
+	PublicBaseURL string // URL prefix for returned object URLs, without trailing slash
+}
+
+// NewLocal creates a Local store rooted at dir, creating it if needed.
+func NewLocal(dir, publicBaseURL string) (*Local, error) {
+	if dir == "" {
+		return nil, errors.New("storage: local directory is required")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Local{Root: dir, PublicBaseURL: strings.TrimRight(publicBaseURL, "/")}, nil
+}
+
+// path maps key to a file below Root, rejecting keys that would escape it.
+func (l *Local) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "..") {
+		return "", errors.New("storage: invalid key")
+	}
+	return filepath.Join(l.Root, filepath.FromSlash(clean)), nil
+}
+
+func (l *Local) Put(ctx context.Context, key string, data []byte, contentType string) (string, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", err
+	}
+	// Write to a temp file and rename so readers never see a partial object.
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return l.PublicBaseURL + "/" + key, nil
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ObjectInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, ObjectInfo{}, err
+	}
+
+	// Files carry no metadata; derive the type from the bytes like the resolver does.
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	ct := imagex.Sniff(head[:n]).MIME()
+	if ct == "" {
+		ct = http.DetectContentType(head[:n])
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, ObjectInfo{}, err
+	}
+
+	h := sha1.Sum([]byte(p + st.ModTime().String()))
+	return f, ObjectInfo{
+		ContentType:  ct,
+		Size:         st.Size(),
+		ETag:         `"` + hex.EncodeToString(h[:8]) + `"`,
+		LastModified: st.ModTime(),
+	}, nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (l *Local) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	if strings.Contains(prefix, "..") {
+		return 0, errors.New("storage: invalid key")
+	}
+	// Only walk the deepest directory the prefix names in full.
+	dir := filepath.Join(l.Root, filepath.FromSlash(path.Dir("/"+prefix+"x")))
+	n := 0
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(l.Root, p)
+		if err != nil || !strings.HasPrefix(filepath.ToSlash(rel), prefix) {
+			return nil
+		}
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		n++
+		return ctx.Err()
+	})
+	if err == nil && strings.HasSuffix(prefix, "/") {
+		_ = os.Remove(dir) // only succeeds if now empty
+	}
+	return n, err
+}
@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3 stores objects in an S3-compatible bucket (AWS S3, MinIO, R2, ...)
+// using path-style requests signed with AWS Signature Version 4.
+type S3 struct {
+	Endpoint      string // e.g. "https://s3.eu-west-1.amazonaws.com" or "http://localhost:9000"
+	Bucket        string
+	Region        string // "us-east-1" if empty
+	AccessKey     string
+	SecretKey     string
+	PublicBaseURL string // URL prefix for returned object URLs; defaults to Endpoint/Bucket
+	Client        *http.Client
+}
+
+// NewS3 validates the configuration and returns an S3 store.
+func NewS3(endpoint, bucket, region, accessKey, secretKey, publicBaseURL string) (*S3, error) {
+	if endpoint == "" || bucket == "" || accessKey == "" || secretKey == "" {
+		return nil, errors.New("storage: S3 endpoint, bucket and credentials are required")
+	}
+	if _, err := url.Parse(endpoint); err != nil {
+		return nil, fmt.Errorf("storage: invalid S3 endpoint: %w", err)
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint = strings.TrimRight(endpoint, "/")
+	if publicBaseURL == "" {
+		publicBaseURL = endpoint + "/" + bucket
+	}
+	return &S3{
+		Endpoint:      endpoint,
+		Bucket:        bucket,
+		Region:        region,
+		AccessKey:     accessKey,
+		SecretKey:     secretKey,
+		PublicBaseURL: strings.TrimRight(publicBaseURL, "/"),
+		Client:        &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) (string, error) {
+	hdr := http.Header{}
+	if contentType != "" {
+		hdr.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(ctx, http.MethodPut, key, hdr, data)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", s3Error(resp)
+	}
+	return s.PublicBaseURL + "/" + escapeKey(key), nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ObjectInfo{}, ErrNotFound
+	default:
+		defer resp.Body.Close()
+		return nil, ObjectInfo{}, s3Error(resp)
+	}
+
+	info := ObjectInfo{
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        resp.ContentLength,
+		ETag:        resp.Header.Get("ETag"),
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.LastModified = t
+	}
+	return resp.Body, info, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return ErrNotFound
+	}
+	return s3Error(resp)
+}
+
+// DeletePrefix lists the keys under prefix (ListObjectsV2) and deletes
+// them one by one.
+func (s *S3) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	var keys []string
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		page, err := s.list(ctx, q)
+		if err != nil {
+			return 0, err
+		}
+		for _, c := range page.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			break
+		}
+		token = page.NextContinuationToken
+	}
+
+	n := 0
+	for _, k := range keys {
+		if err := s.Delete(ctx, k); err != nil && !errors.Is(err, ErrNotFound) {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// listResult is the part of a ListObjectsV2 response DeletePrefix needs.
+type listResult struct {
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (s *S3) list(ctx context.Context, q url.Values) (*listResult, error) {
+	u, err := url.Parse(s.Endpoint + "/" + s.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	// Encode sorts by key, as the canonical query string requires.
+	u.RawQuery = strings.ReplaceAll(q.Encode(), "+", "%20")
+	resp, err := s.send(ctx, http.MethodGet, u, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3Error(resp)
+	}
+	var out listResult
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(&out); err != nil {
+		return nil, fmt.Errorf("storage: S3 list: %w", err)
+	}
+	return &out, nil
+}
+
+// do builds, signs and sends a single-object request.
+func (s *S3) do(ctx context.Context, method, key string, hdr http.Header, body []byte) (*http.Response, error) {
+	u, err := url.Parse(s.Endpoint + "/" + s.Bucket + "/" + escapeKey(key))
+	if err != nil {
+		return nil, err
+	}
+	return s.send(ctx, method, u, hdr, body)
+}
+
+// send signs and sends a request for u.
+func (s *S3) send(ctx context.Context, method string, u *url.URL, hdr http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+	req.ContentLength = int64(len(body))
+	s.sign(req, body, time.Now().UTC())
+	return s.Client.Do(req)
+}
+
+// sign adds SigV4 headers to req. See
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (s *S3) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// Canonical headers: lower-cased names, sorted, trimmed values.
+	names := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		names = append(names, strings.ToLower(k))
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, n := range names {
+		canonHeaders.WriteString(n + ":" + strings.TrimSpace(req.Header.Get(n)) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonReq := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonReq))
+
+	kDate := hmacSHA256([]byte("AWS4"+s.SecretKey), day)
+	kRegion := hmacSHA256(kDate, s.Region)
+	kService := hmacSHA256(kRegion, "s3")
+	kSigning := hmacSHA256(kService, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(kSigning, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+sig)
+	// net/http sends Host from req.Host, not the header map.
+	req.Header.Del("Host")
+}
+
+// escapeKey percent-encodes each path segment of key per RFC 3986,
+// which is what SigV4 expects for the canonical URI.
+func escapeKey(key string) string {
+	parts := strings.Split(key, "/")
+	for i, p := range parts {
+		parts[i] = uriEncode(p)
+	}
+	return strings.Join(parts, "/")
+}
+
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteString("%" + strings.ToUpper(strconv.FormatUint(uint64(c)>>4, 16)+strconv.FormatUint(uint64(c)&0xf, 16)))
+	}
+	return b.String()
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, msg string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(msg))
+	return m.Sum(nil)
+}
+
+func s3Error(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("storage: S3 %s: %s", resp.Status, bytes.TrimSpace(msg))
+}
@@ -0,0 +1,70 @@
+// Package storage defines where icon bytes live once resolved. Backends
+// (Cloudinary, local filesystem, S3-compatible) implement ObjectStore and
+// are selected at startup via STORAGE_BACKEND.
+package storage
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by Get and Delete when no object exists for a key.
+var ErrNotFound = errors.New("storage: object not found")
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	ContentType  string
+	Size         int64 // -1 if unknown
+	ETag         string
+	LastModified time.Time
+}
+
+// ObjectStore stores icon bytes under opaque keys and returns URLs that
+// clients can load them from.
+type ObjectStore interface {
+	// Put stores data under key, overwriting any existing object, and
+	// returns the public URL of the stored object.
+	Put(ctx context.Context, key string, data []byte, contentType string) (string, error)
+	// Get opens the object stored under key. The caller must close the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	// Delete removes the object stored under key.
+	Delete(ctx context.Context, key string) error
+	// DeletePrefix removes every object whose key starts with prefix and
+	// returns how many were removed.
+	DeletePrefix(ctx context.Context, prefix string) (int, error)
+}
+
+// ObjectKey is the per-domain key icons were stored under before
+// content-addressed blobs (see BlobKey), derived from the source URL src.
+// Such objects keep being served until the icon is next re-stored.
+func ObjectKey(domain, src string) string {
+	h := sha1.Sum([]byte(src))
+	return DomainPrefix(domain) + hex.EncodeToString(h[:])
+}
+
+// KeyPrefix is the prefix of every key Favget stores objects under.
+const KeyPrefix = "favget/"
+
+// DomainPrefix is the key prefix of the per-domain objects stored for
+// domain (see ObjectKey) and their renditions.
+func DomainPrefix(domain string) string {
+	return KeyPrefix + domain + "/"
+}
+
+// BlobKey is where the content with the given hex SHA-256 is stored. Every
+// domain whose icon has exactly these bytes shares the object.
+func BlobKey(contentHash string) string {
+	return KeyPrefix + "blobs/" + contentHash
+}
+
+// BlobHash returns the content hash key was built from by BlobKey, and
+// false for any other key.
+func BlobHash(key string) (string, bool) {
+	hash, ok := strings.CutPrefix(key, KeyPrefix+"blobs/")
+	return hash, ok && hash != "" && !strings.Contains(hash, "/")
+}
@@ -0,0 +1,197 @@
+package storage_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kudanilll/favget/internal/storage"
+)
+
+var pngMagic = []byte("\x89PNG\r\n\x1a\n rest of the image")
+
+// exercise runs the same Put/Get/Delete round trip against any backend.
+func exercise(t *testing.T, st storage.ObjectStore, wantURLPrefix string) {
+	t.Helper()
+	ctx := context.Background()
+	key := storage.ObjectKey("example.com", "https://example.com/favicon.png")
+
+	u, err := st.Put(ctx, key, pngMagic, "image/png")
+	if err != nil {
+		t.Fatalf("Put error: %v", err)
+	}
+	if !strings.HasPrefix(u, wantURLPrefix) || !strings.HasSuffix(u, key) {
+		t.Fatalf("Put URL = %q, want %q + key", u, wantURLPrefix)
+	}
+
+	body, info, err := st.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	got, _ := io.ReadAll(body)
+	body.Close()
+	if string(got) != string(pngMagic) {
+		t.Fatalf("Get body = %q, want %q", got, pngMagic)
+	}
+	if info.ContentType != "image/png" {
+		t.Fatalf("Get content type = %q, want image/png", info.ContentType)
+	}
+
+	if err := st.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+	if _, _, err := st.Get(ctx, key); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Get after Delete error = %v, want ErrNotFound", err)
+	}
+
+	// DeletePrefix removes a domain's icon and renditions, and nothing else.
+	other := storage.ObjectKey("example.org", "https://example.org/favicon.png")
+	for _, k := range []string{key, key + "_64_png", other} {
+		if _, err := st.Put(ctx, k, pngMagic, "image/png"); err != nil {
+			t.Fatalf("Put %s error: %v", k, err)
+		}
+	}
+	n, err := st.DeletePrefix(ctx, storage.DomainPrefix("example.com"))
+	if err != nil || n != 2 {
+		t.Fatalf("DeletePrefix = %d, %v; want 2, nil", n, err)
+	}
+	if _, _, err := st.Get(ctx, key+"_64_png"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Get after DeletePrefix error = %v, want ErrNotFound", err)
+	}
+	body, _, err = st.Get(ctx, other)
+	if err != nil {
+		t.Fatalf("DeletePrefix removed another domain's object: %v", err)
+	}
+	body.Close()
+	if err := st.Delete(ctx, other); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	t.Parallel()
+
+	st, err := storage.NewLocal(t.TempDir(), "/objects/")
+	if err != nil {
+		t.Fatalf("NewLocal error: %v", err)
+	}
+	exercise(t, st, "/objects/favget/example.com/")
+
+	if _, err := st.Put(context.Background(), "../escape", pngMagic, "image/png"); err == nil {
+		t.Fatalf("Put accepted a key escaping the root")
+	}
+}
+
+// fakeS3 is a minimal path-style S3 server that checks requests are signed
+// and that the declared payload hash matches the body.
+func fakeS3(t *testing.T) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	types := map[string]string{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AK/") {
+			http.Error(w, "missing signature", http.StatusForbidden)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		sum := sha256.Sum256(body)
+		if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+			http.Error(w, "payload hash mismatch", http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path != "/icons" && !strings.HasPrefix(r.URL.Path, "/icons/") {
+			http.Error(w, "no such bucket", http.StatusNotFound)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+			// ListObjectsV2, one key per page to exercise continuation.
+			prefix := "/icons/" + r.URL.Query().Get("prefix")
+			var keys []string
+			for k := range objects {
+				if strings.HasPrefix(k, prefix) {
+					keys = append(keys, strings.TrimPrefix(k, "/icons/"))
+				}
+			}
+			sort.Strings(keys)
+			after := r.URL.Query().Get("continuation-token")
+			for len(keys) > 0 && keys[0] <= after {
+				keys = keys[1:]
+			}
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">`)
+			if len(keys) > 0 {
+				fmt.Fprintf(w, "<Contents><Key>%s</Key></Contents>", keys[0])
+			}
+			if len(keys) > 1 {
+				fmt.Fprintf(w, "<IsTruncated>true</IsTruncated><NextContinuationToken>%s</NextContinuationToken>", keys[0])
+			}
+			fmt.Fprint(w, "</ListBucketResult>")
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			objects[r.URL.Path] = body
+			types[r.URL.Path] = r.Header.Get("Content-Type")
+		case http.MethodGet:
+			b, ok := objects[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", types[r.URL.Path])
+			_, _ = w.Write(b)
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+}
+
+func TestS3(t *testing.T) {
+	t.Parallel()
+
+	srv := fakeS3(t)
+	defer srv.Close()
+
+	st, err := storage.NewS3(srv.URL, "icons", "", "AK", "SK", "")
+	if err != nil {
+		t.Fatalf("NewS3 error: %v", err)
+	}
+	exercise(t, st, srv.URL+"/icons/favget/example.com/")
+}
+
+// TestS3MinIO runs the round trip against a real S3-compatible server.
+// It is skipped unless FAVGET_TEST_S3_ENDPOINT is set, e.g.:
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	mc mb local/favget-test
+//	FAVGET_TEST_S3_ENDPOINT=http://localhost:9000 FAVGET_TEST_S3_BUCKET=favget-test \
+//	FAVGET_TEST_S3_ACCESS_KEY=minioadmin FAVGET_TEST_S3_SECRET_KEY=minioadmin go test ./internal/storage
+func TestS3MinIO(t *testing.T) {
+	endpoint := os.Getenv("FAVGET_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("FAVGET_TEST_S3_ENDPOINT not set")
+	}
+	bucket := os.Getenv("FAVGET_TEST_S3_BUCKET")
+	st, err := storage.NewS3(endpoint, bucket, os.Getenv("FAVGET_TEST_S3_REGION"),
+		os.Getenv("FAVGET_TEST_S3_ACCESS_KEY"), os.Getenv("FAVGET_TEST_S3_SECRET_KEY"), "")
+	if err != nil {
+		t.Fatalf("NewS3 error: %v", err)
+	}
+	exercise(t, st, strings.TrimRight(endpoint, "/")+"/"+bucket+"/")
+}
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Blob is one stored icon content, shared by every icon and history
+// version with the same bytes.
+type Blob struct {
+	Hash        string // hex SHA-256 of the content
+	StorageKey  string
+	StorageURL  string // empty until the upload succeeded
+	ContentType *string
+	Size        int64
+}
+
+// ClaimBlob registers b, or marks an existing blob with the same hash as
+// just used so the sweeper leaves it alone, and returns the stored row.
+// A returned blob with an empty StorageURL still needs uploading.
+func (d *DB) ClaimBlob(ctx context.Context, b Blob) (*Blob, error) {
+	out := Blob{}
+	err := d.Pool.QueryRow(ctx, `
+		INSERT INTO blobs (hash, storage_key, content_type, size)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (hash) DO UPDATE SET touched_at=NOW()
+		RETURNING hash, storage_key, storage_url, content_type, size`,
+		b.Hash, b.StorageKey, b.ContentType, b.Size,
+	).Scan(&out.Hash, &out.StorageKey, &out.StorageURL, &out.ContentType, &out.Size)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetBlobLocation records where an uploaded blob is stored and can be
+// loaded from.
+func (d *DB) SetBlobLocation(ctx context.Context, hash, key, url string) error {
+	_, err := d.Pool.Exec(ctx, `
+		UPDATE blobs SET storage_key=$2, storage_url=$3, touched_at=NOW() WHERE hash=$1`, hash, key, url)
+	return err
+}
+
+// AddBlobRendition records key as a rendition derived from the blob with
+// the given hash, so SweepOrphanBlobs can hand it to del. Blobs whose
+// renditions predate this record (see SweepOrphanBlobs) are left as they are.
+func (d *DB) AddBlobRendition(ctx context.Context, hash, key string) error {
+	_, err := d.Pool.Exec(ctx, `
+		UPDATE blobs SET renditions = array_append(renditions, $2)
+		WHERE hash=$1 AND renditions IS NOT NULL AND NOT $2 = ANY(renditions)`, hash, key)
+	return err
+}
+
+// SweepOrphanBlobs deletes up to limit blobs that no icon or history
+// version references and that have not been claimed for at least grace;
+// with hashes, only those blobs are considered. del is called with each
+// blob's storage key and rendition keys while its row is locked, so a
+// concurrent ClaimBlob waits and re-uploads rather than reusing an object
+// being deleted; renditions is nil for blobs created before renditions were
+// recorded. Blobs whose del fails are kept for the next sweep. It returns
+// how many blobs were deleted.
+//
+// The grace period covers the window between ClaimBlob and the icon write
+// that references the blob.
+func (d *DB) SweepOrphanBlobs(ctx context.Context, hashes []string, grace time.Duration, limit int, del func(key string, renditions []string) error) (int, error) {
+	deleted := 0
+	err := pgx.BeginFunc(ctx, d.Pool, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT hash, storage_key, renditions, renditions IS NOT NULL FROM blobs
+			WHERE refcount <= 0 AND touched_at < $1 AND ($2::text[] IS NULL OR hash = ANY($2))
+			ORDER BY touched_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED`, time.Now().Add(-grace), hashes, limit)
+		if err != nil {
+			return err
+		}
+		type orphan struct {
+			hash, key  string
+			renditions []string
+		}
+		var orphans []orphan
+		for rows.Next() {
+			var o orphan
+			var known bool
+			if err := rows.Scan(&o.hash, &o.key, &o.renditions, &known); err != nil {
+				rows.Close()
+				return err
+			}
+			if known && o.renditions == nil {
+				o.renditions = []string{}
+			}
+			orphans = append(orphans, o)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		var gone []string
+		for _, o := range orphans {
+			if err := del(o.key, o.renditions); err == nil {
+				gone = append(gone, o.hash)
+			}
+		}
+		if len(gone) == 0 {
+			return nil
+		}
+		_, err = tx.Exec(ctx, `DELETE FROM blobs WHERE hash = ANY($1)`, gone)
+		deleted = len(gone)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -15,7 +16,22 @@ type IconRecord struct {
 	Width       *int32
 	Height      *int32
 	ContentType *string
-	UpdatedAt   time.Time
+	UpdatedAt   time.Time // last content change
+	CheckedAt   time.Time // last revalidation; UpdatedAt for rows never revalidated
+	ContentHash *string   // blob holding the bytes; nil for icons stored before blobs existed
+}
+
+// iconColumns is the SELECT/RETURNING list scanned by scanIcon.
+const iconColumns = `domain, icon_url, source_url, etag, width, height, content_type, updated_at, COALESCE(checked_at, updated_at), content_hash`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanIcon(row rowScanner) (IconRecord, error) {
+	rec := IconRecord{}
+	err := row.Scan(&rec.Domain, &rec.IconURL, &rec.SourceURL, &rec.ETag, &rec.Width, &rec.Height, &rec.ContentType, &rec.UpdatedAt, &rec.CheckedAt, &rec.ContentHash)
+	return rec, err
 }
 
 type DB struct{ Pool *pgxpool.Pool }
@@ -32,20 +48,23 @@ func New(ctx context.Context, url string) (*DB, error) {
 }
 
 func (d *DB) FindByDomain(ctx context.Context, domain string) (*IconRecord, error) {
-	row := d.Pool.QueryRow(ctx, `
-		SELECT domain, icon_url, source_url, etag, width, height, content_type, updated_at
-		FROM icons WHERE domain=$1`, domain)
-	rec := IconRecord{}
-	if err := row.Scan(&rec.Domain, &rec.IconURL, &rec.SourceURL, &rec.ETag, &rec.Width, &rec.Height, &rec.ContentType, &rec.UpdatedAt); err != nil {
+	row := d.Pool.QueryRow(ctx, `SELECT `+iconColumns+` FROM icons WHERE domain=$1`, domain)
+	rec, err := scanIcon(row)
+	if err != nil {
 		return nil, err
 	}
 	return &rec, nil
 }
 
-func (d *DB) Upsert(ctx context.Context, rec IconRecord) error {
-	_, err := d.Pool.Exec(ctx, `
-		INSERT INTO icons (domain, icon_url, source_url, etag, width, height, content_type, updated_at)
-		VALUES ($1,$2,$3,$4,$5,$6,$7, NOW())
+// Upsert inserts or replaces the row for rec.Domain and returns its
+// updated_at. updated_at only moves when the content hash changes, so
+// re-storing the same bytes keeps validators and renditions; checked_at is
+// always bumped.
+func (d *DB) Upsert(ctx context.Context, rec IconRecord) (time.Time, error) {
+	var updatedAt time.Time
+	err := d.Pool.QueryRow(ctx, `
+		INSERT INTO icons (domain, icon_url, source_url, etag, width, height, content_type, content_hash, updated_at, checked_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8, NOW(), NOW())
 		ON CONFLICT (domain) DO UPDATE SET
 		  icon_url=EXCLUDED.icon_url,
 		  source_url=EXCLUDED.source_url,
@@ -53,8 +72,101 @@ func (d *DB) Upsert(ctx context.Context, rec IconRecord) error {
 		  width=EXCLUDED.width,
 		  height=EXCLUDED.height,
 		  content_type=EXCLUDED.content_type,
-		  updated_at=NOW();
-	`, rec.Domain, rec.IconURL, rec.SourceURL, rec.ETag, rec.Width, rec.Height, rec.ContentType)
+		  content_hash=EXCLUDED.content_hash,
+		  updated_at=CASE WHEN icons.content_hash IS DISTINCT FROM EXCLUDED.content_hash
+		    THEN NOW() ELSE icons.updated_at END,
+		  checked_at=NOW()
+		RETURNING updated_at;
+	`, rec.Domain, rec.IconURL, rec.SourceURL, rec.ETag, rec.Width, rec.Height, rec.ContentType, rec.ContentHash).Scan(&updatedAt)
+	return updatedAt, err
+}
+
+// ClaimStale returns up to limit icons last checked before the given time,
+// oldest first, and marks them checked now. Rows locked by a concurrent
+// claim are skipped, so several replicas can refresh without overlap.
+func (d *DB) ClaimStale(ctx context.Context, before time.Time, limit int) ([]IconRecord, error) {
+	rows, err := d.Pool.Query(ctx, `
+		UPDATE icons SET checked_at=NOW()
+		WHERE domain IN (
+		  SELECT domain FROM icons
+		  WHERE COALESCE(checked_at, updated_at) < $1
+		  ORDER BY COALESCE(checked_at, updated_at)
+		  LIMIT $2
+		  FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+iconColumns, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []IconRecord
+	for rows.Next() {
+		rec, err := scanIcon(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// ClaimIfStale marks domain checked now if it was last checked before the
+// given time, and returns the claimed row. It returns pgx.ErrNoRows when the
+// icon is fresh or another request claimed it first.
+func (d *DB) ClaimIfStale(ctx context.Context, domain string, before time.Time) (*IconRecord, error) {
+	row := d.Pool.QueryRow(ctx, `
+		UPDATE icons SET checked_at=NOW()
+		WHERE domain=$1 AND COALESCE(checked_at, updated_at) < $2
+		RETURNING `+iconColumns, domain, before)
+	rec, err := scanIcon(row)
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// Delete removes the row for domain and returns it, or pgx.ErrNoRows if
+// there was none.
+func (d *DB) Delete(ctx context.Context, domain string) (*IconRecord, error) {
+	row := d.Pool.QueryRow(ctx, `DELETE FROM icons WHERE domain=$1 RETURNING `+iconColumns, domain)
+	rec, err := scanIcon(row)
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// DeleteMatching removes every row whose domain matches pattern, where "*"
+// matches any run of characters ("*" alone deletes everything), and returns
+// the removed rows.
+func (d *DB) DeleteMatching(ctx context.Context, pattern string) ([]IconRecord, error) {
+	like := likeEscaper.Replace(pattern)
+	like = strings.ReplaceAll(like, "*", "%")
+	rows, err := d.Pool.Query(ctx, `DELETE FROM icons WHERE domain LIKE $1 RETURNING `+iconColumns, like)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []IconRecord
+	for rows.Next() {
+		rec, err := scanIcon(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// likeEscaper escapes LIKE's own wildcards, using its default escape character.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// SetSource records where an icon is now fetched from and its upstream
+// ETag without touching updated_at, for icons whose bytes did not change.
+func (d *DB) SetSource(ctx context.Context, domain, sourceURL string, etag *string) error {
+	_, err := d.Pool.Exec(ctx, `UPDATE icons SET source_url=$2, etag=$3 WHERE domain=$1`, domain, sourceURL, etag)
 	return err
 }
 
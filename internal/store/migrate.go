@@ -0,0 +1,241 @@
+package store
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Schema changes live in migrations/ as <version>_<name>.up.sql and
+// <version>_<name>.down.sql pairs, applied in version order. The versions
+// applied to a database are recorded in schema_migrations.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is one versioned schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+var (
+	// ErrSchemaTooNew means the database was migrated by a newer Favget;
+	// this binary does not know its schema and refuses to use it.
+	ErrSchemaTooNew = errors.New("store: database schema is newer than this binary")
+	// ErrSchemaOutdated means migrations are pending.
+	ErrSchemaOutdated = errors.New("store: database schema is out of date; run migrations")
+)
+
+// migrationLockID is the pg_advisory_lock key held while migrating, so
+// replicas starting together apply each migration once.
+const migrationLockID = 0x66617667 // "favg"
+
+// Migrations returns the embedded migrations in version order.
+func Migrations() ([]Migration, error) {
+	return parseMigrations(migrationFiles, "migrations")
+}
+
+func parseMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("store: migration %s: want <version>_<name>.up.sql or .down.sql", name)
+		}
+		num, label, _ := strings.Cut(base, "_")
+		v, err := strconv.Atoi(num)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("store: migration %s: invalid version", name)
+		}
+		body, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[v]
+		if m == nil {
+			m = &Migration{Version: v, Name: label}
+			byVersion[v] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("store: migration version %d used by %q and %q", v, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("store: migration %d_%s needs both up and down files", m.Version, m.Name)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	for i, m := range out {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("store: migration versions must be 1..n without gaps; found %d at position %d", m.Version, i+1)
+		}
+	}
+	return out, nil
+}
+
+// MigrationStatus reports the schema version of a database.
+type MigrationStatus struct {
+	Current int // highest applied version; 0 for an empty database
+	Latest  int // highest version known to this binary
+}
+
+// Pending reports whether migrations remain to be applied.
+func (s MigrationStatus) Pending() bool { return s.Current < s.Latest }
+
+// SchemaStatus returns the current and latest schema versions without
+// changing anything.
+func (d *DB) SchemaStatus(ctx context.Context) (MigrationStatus, error) {
+	ms, err := Migrations()
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+	st := MigrationStatus{Latest: len(ms)}
+	var exists bool
+	if err := d.Pool.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return st, err
+	}
+	if !exists {
+		return st, nil
+	}
+	err = d.Pool.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&st.Current)
+	return st, err
+}
+
+// CheckSchema returns ErrSchemaTooNew or ErrSchemaOutdated unless the
+// database is exactly at the latest version.
+func (d *DB) CheckSchema(ctx context.Context) error {
+	st, err := d.SchemaStatus(ctx)
+	if err != nil {
+		return err
+	}
+	return checkStatus(st)
+}
+
+func checkStatus(st MigrationStatus) error {
+	switch {
+	case st.Current > st.Latest:
+		return fmt.Errorf("%w (database at %d, binary knows %d)", ErrSchemaTooNew, st.Current, st.Latest)
+	case st.Current < st.Latest:
+		return fmt.Errorf("%w (database at %d, latest is %d)", ErrSchemaOutdated, st.Current, st.Latest)
+	}
+	return nil
+}
+
+// Migrate applies every pending migration, each in its own transaction, and
+// returns how many were applied. It refuses to touch a database whose schema
+// is newer than this binary.
+func (d *DB) Migrate(ctx context.Context) (int, error) {
+	ms, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	err = d.withMigrationLock(ctx, func(conn *pgxpool.Conn, current int) error {
+		if current > len(ms) {
+			return checkStatus(MigrationStatus{Current: current, Latest: len(ms)})
+		}
+		for _, m := range ms[current:] {
+			if err := applyMigration(ctx, conn, m.Version, m.Up, true); err != nil {
+				return fmt.Errorf("store: migration %d_%s up: %w", m.Version, m.Name, err)
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// MigrateDown reverts the last steps applied migrations, newest first, and
+// returns how many were reverted.
+func (d *DB) MigrateDown(ctx context.Context, steps int) (int, error) {
+	ms, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	err = d.withMigrationLock(ctx, func(conn *pgxpool.Conn, current int) error {
+		if current > len(ms) {
+			return checkStatus(MigrationStatus{Current: current, Latest: len(ms)})
+		}
+		for v := current; v > 0 && n < steps; v-- {
+			m := ms[v-1]
+			if err := applyMigration(ctx, conn, m.Version, m.Down, false); err != nil {
+				return fmt.Errorf("store: migration %d_%s down: %w", m.Version, m.Name, err)
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// withMigrationLock runs fn on a dedicated connection holding the migration
+// advisory lock, with schema_migrations created and its current version read.
+func (d *DB) withMigrationLock(ctx context.Context, fn func(conn *pgxpool.Conn, current int) error) error {
+	conn, err := d.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	if _, err := conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+		  version BIGINT PRIMARY KEY,
+		  applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`); err != nil {
+		return err
+	}
+	var current int
+	if err := conn.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+	return fn(conn, current)
+}
+
+// applyMigration runs sql and records (up) or forgets (down) version in the
+// same transaction.
+func applyMigration(ctx context.Context, conn *pgxpool.Conn, version int, sql string, up bool) error {
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, sql); err != nil {
+			return err
+		}
+		var err error
+		if up {
+			_, err = tx.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version)
+		} else {
+			_, err = tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version=$1`, version)
+		}
+		return err
+	})
+}
@@ -0,0 +1,218 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestMigrations(t *testing.T) {
+	t.Parallel()
+
+	ms, err := Migrations()
+	if err != nil {
+		t.Fatalf("Migrations: %v", err)
+	}
+	if len(ms) == 0 || ms[0].Name != "create_icons" {
+		t.Fatalf("first migration = %+v, want create_icons", ms)
+	}
+	// The queries in db.go read checked_at, so the latest schema must have it.
+	found := false
+	for _, m := range ms {
+		found = found || strings.Contains(m.Up, "checked_at")
+	}
+	if !found {
+		t.Fatal("no migration adds icons.checked_at")
+	}
+}
+
+func TestParseMigrationsRejects(t *testing.T) {
+	t.Parallel()
+
+	file := func(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+	tests := []struct {
+		name string
+		fs   fstest.MapFS
+	}{
+		{"missing-down", fstest.MapFS{"m/0001_a.up.sql": file("SELECT 1")}},
+		{"gap", fstest.MapFS{
+			"m/0001_a.up.sql": file("SELECT 1"), "m/0001_a.down.sql": file("SELECT 1"),
+			"m/0003_c.up.sql": file("SELECT 1"), "m/0003_c.down.sql": file("SELECT 1"),
+		}},
+		{"duplicate-version", fstest.MapFS{
+			"m/0001_a.up.sql": file("SELECT 1"), "m/0001_b.down.sql": file("SELECT 1"),
+		}},
+		{"bad-name", fstest.MapFS{"m/first.sql": file("SELECT 1")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := parseMigrations(tt.fs, "m"); err == nil {
+				t.Fatal("parseMigrations accepted an invalid set")
+			}
+		})
+	}
+}
+
+func TestCheckStatus(t *testing.T) {
+	t.Parallel()
+
+	if err := checkStatus(MigrationStatus{Current: 2, Latest: 2}); err != nil {
+		t.Fatalf("up to date: %v", err)
+	}
+	if err := checkStatus(MigrationStatus{Current: 1, Latest: 2}); !errors.Is(err, ErrSchemaOutdated) {
+		t.Fatalf("behind: err = %v, want ErrSchemaOutdated", err)
+	}
+	if err := checkStatus(MigrationStatus{Current: 3, Latest: 2}); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("ahead: err = %v, want ErrSchemaTooNew", err)
+	}
+}
+
+// TestMigratePostgres runs every migration up, down and up again against a
+// scratch database. It is skipped unless FAVGET_TEST_DATABASE_URL is set, e.g.:
+//
+//	docker run -e POSTGRES_PASSWORD=pw -p 5432:5432 postgres
+//	FAVGET_TEST_DATABASE_URL=postgres://postgres:pw@localhost:5432/postgres go test ./internal/store
+func TestMigratePostgres(t *testing.T) {
+	url := os.Getenv("FAVGET_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("FAVGET_TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	db, err := New(ctx, url)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	ms, _ := Migrations()
+	if _, err := db.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if err := db.CheckSchema(ctx); err != nil {
+		t.Fatalf("CheckSchema after Migrate: %v", err)
+	}
+	if n, err := db.MigrateDown(ctx, len(ms)); err != nil || n != len(ms) {
+		t.Fatalf("MigrateDown = %d, %v; want %d", n, err, len(ms))
+	}
+	if n, err := db.Migrate(ctx); err != nil || n != len(ms) {
+		t.Fatalf("Migrate again = %d, %v; want %d", n, err, len(ms))
+	}
+
+	// Icon history: identical content is recorded once; rows outlive the
+	// icon until deleted explicitly.
+	for _, h := range []string{"h1", "h2"} {
+		if _, err := db.ClaimBlob(ctx, Blob{Hash: h, StorageKey: "k-" + h, Size: 1}); err != nil {
+			t.Fatalf("ClaimBlob %s: %v", h, err)
+		}
+	}
+	h1, h2 := "h1", "h2"
+
+	// updated_at only moves with the content hash.
+	rec := IconRecord{Domain: "updated.example", IconURL: "https://cdn.example/u", ContentHash: &h1}
+	first, err := db.Upsert(ctx, rec)
+	if err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	rec.SourceURL = "https://updated.example/moved.png"
+	if again, err := db.Upsert(ctx, rec); err != nil || !again.Equal(first) {
+		t.Fatalf("Upsert with unchanged content = %v, %v; want updated_at %v kept", again, err, first)
+	}
+	rec.ContentHash = &h2
+	if changed, err := db.Upsert(ctx, rec); err != nil || !changed.After(first) {
+		t.Fatalf("Upsert with new content = %v, %v; want updated_at after %v", changed, err, first)
+	}
+	if _, err := db.Delete(ctx, "updated.example"); err != nil {
+		t.Fatalf("Delete updated.example: %v", err)
+	}
+
+	if _, err := db.Upsert(ctx, IconRecord{Domain: "history.example", IconURL: "https://cdn.example/a", ContentHash: &h1}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	v := IconVersion{Domain: "history.example", StorageURL: "https://cdn.example/v/1", StorageKey: "k1", ContentHash: "h1"}
+	if _, err := db.AddVersion(ctx, v); err != nil {
+		t.Fatalf("AddVersion: %v", err)
+	}
+	if _, err := db.AddVersion(ctx, v); !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("AddVersion with unchanged content: err = %v, want ErrNoRows", err)
+	}
+	v.ContentHash = "h2"
+	if _, err := db.AddVersion(ctx, v); err != nil {
+		t.Fatalf("AddVersion h2: %v", err)
+	}
+	if vs, err := db.ListVersions(ctx, "history.example", 10); err != nil || len(vs) != 2 || vs[0].ContentHash != "h2" {
+		t.Fatalf("ListVersions = %+v, %v; want h2, h1", vs, err)
+	}
+	if _, err := db.Delete(ctx, "history.example"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if vs, _ := db.ListVersions(ctx, "history.example", 10); len(vs) != 2 {
+		t.Fatalf("versions after Delete = %+v; want both kept", vs)
+	}
+	if vs, err := db.DeleteVersions(ctx, "history.*"); err != nil || len(vs) != 2 {
+		t.Fatalf("DeleteVersions = %+v, %v; want 2", vs, err)
+	}
+	if vs, _ := db.ListVersions(ctx, "history.example", 10); len(vs) != 0 {
+		t.Fatalf("versions left after DeleteVersions: %+v", vs)
+	}
+
+	// Blobs: referenced ones survive a sweep; unreferenced ones go once the
+	// grace period has passed, with the renditions recorded for them. A
+	// blob from before renditions were recorded reports them as unknown.
+	if _, err := db.Upsert(ctx, IconRecord{Domain: "blob.example", IconURL: "https://cdn.example/b", ContentHash: &h2}); err != nil {
+		t.Fatalf("Upsert blob.example: %v", err)
+	}
+	for _, k := range []string{"k-h1_32_png", "k-h1_32_png", "k-h1_0_svg"} {
+		if err := db.AddBlobRendition(ctx, "h1", k); err != nil {
+			t.Fatalf("AddBlobRendition %s: %v", k, err)
+		}
+	}
+	if _, err := db.Pool.Exec(ctx, `UPDATE blobs SET renditions = NULL WHERE hash = 'h2'`); err != nil {
+		t.Fatalf("clear h2 renditions: %v", err)
+	}
+	if err := db.AddBlobRendition(ctx, "h2", "k-h2_32_png"); err != nil {
+		t.Fatalf("AddBlobRendition h2: %v", err)
+	}
+	var keys []string
+	renditions := map[string][]string{}
+	del := func(key string, rs []string) error {
+		keys = append(keys, key)
+		renditions[key] = rs
+		return nil
+	}
+	if n, err := db.SweepOrphanBlobs(ctx, nil, time.Hour, 10, del); err != nil || n != 0 {
+		t.Fatalf("SweepOrphanBlobs within grace = %d, %v; want 0", n, err)
+	}
+	if n, err := db.SweepOrphanBlobs(ctx, nil, 0, 10, del); err != nil || n != 1 || len(keys) != 1 || keys[0] != "k-h1" {
+		t.Fatalf("SweepOrphanBlobs = %d, %v, %v; want only k-h1", n, err, keys)
+	}
+	if rs := renditions["k-h1"]; len(rs) != 2 || rs[0] != "k-h1_32_png" || rs[1] != "k-h1_0_svg" {
+		t.Fatalf("renditions of k-h1 = %v, want each recorded once", rs)
+	}
+	if _, err := db.Delete(ctx, "blob.example"); err != nil {
+		t.Fatalf("Delete blob.example: %v", err)
+	}
+	if n, err := db.SweepOrphanBlobs(ctx, []string{"h2"}, 0, 10, del); err != nil || n != 1 {
+		t.Fatalf("SweepOrphanBlobs after Delete = %d, %v; want 1", n, err)
+	}
+	if rs, ok := renditions["k-h2"]; !ok || rs != nil {
+		t.Fatalf("renditions of k-h2 = %v, want nil (unknown)", rs)
+	}
+
+	// A version from a newer binary makes this one refuse the database.
+	if _, err := db.Pool.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, len(ms)+1); err != nil {
+		t.Fatalf("insert future version: %v", err)
+	}
+	t.Cleanup(func() {
+		_, _ = db.Pool.Exec(context.Background(), `DELETE FROM schema_migrations WHERE version > $1`, len(ms))
+	})
+	if _, err := db.Migrate(ctx); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("Migrate on newer schema: err = %v, want ErrSchemaTooNew", err)
+	}
+}
@@ -0,0 +1,12 @@
+-- The original hand-created table. IF NOT EXISTS lets databases set up from
+-- the README before migrations existed adopt them.
+CREATE TABLE IF NOT EXISTS icons (
+  domain TEXT PRIMARY KEY,
+  icon_url TEXT NOT NULL,
+  source_url TEXT,
+  etag TEXT,
+  width INT,
+  height INT,
+  content_type VARCHAR(64),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
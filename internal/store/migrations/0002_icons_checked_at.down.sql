@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS icons_checked_at_idx;
+ALTER TABLE icons DROP COLUMN IF EXISTS checked_at;
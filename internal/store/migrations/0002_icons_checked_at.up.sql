@@ -0,0 +1,4 @@
+-- Last revalidation by the background refresher or a stale-while-revalidate
+-- request; NULL means "same as updated_at".
+ALTER TABLE icons ADD COLUMN IF NOT EXISTS checked_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS icons_checked_at_idx ON icons ((COALESCE(checked_at, updated_at)));
@@ -0,0 +1,15 @@
+-- Append-only history of each domain's icon: one row per distinct content,
+-- written when the resolved bytes change. Rows go with the icons row (purge).
+CREATE TABLE IF NOT EXISTS icon_versions (
+  id BIGSERIAL PRIMARY KEY,
+  domain TEXT NOT NULL REFERENCES icons(domain) ON DELETE CASCADE,
+  source_url TEXT,
+  storage_url TEXT NOT NULL,
+  storage_key TEXT NOT NULL,
+  content_hash TEXT NOT NULL,
+  content_type VARCHAR(64),
+  width INT,
+  height INT,
+  detected_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS icon_versions_domain_idx ON icon_versions (domain, id DESC);
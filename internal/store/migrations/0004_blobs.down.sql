@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS icon_versions_blob_refcount ON icon_versions;
+DROP TRIGGER IF EXISTS icons_blob_refcount ON icons;
+DROP FUNCTION IF EXISTS favget_blob_refcount();
+ALTER TABLE icon_versions DROP CONSTRAINT IF EXISTS icon_versions_content_hash_fkey;
+DROP INDEX IF EXISTS icon_versions_content_hash_idx;
+ALTER TABLE icons DROP COLUMN IF EXISTS content_hash;
+DROP TABLE IF EXISTS blobs;
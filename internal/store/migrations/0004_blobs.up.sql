@@ -0,0 +1,49 @@
+-- Content-addressed icon bytes. Icons and history versions reference a blob
+-- by the SHA-256 of its content, so identical icons are stored once.
+-- refcount is maintained by the triggers below; blobs left at zero are
+-- deleted by the background sweeper.
+CREATE TABLE IF NOT EXISTS blobs (
+  hash TEXT PRIMARY KEY,
+  storage_key TEXT NOT NULL,
+  storage_url TEXT NOT NULL DEFAULT '',
+  content_type VARCHAR(64),
+  size BIGINT NOT NULL,
+  refcount INT NOT NULL DEFAULT 0,
+  touched_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS blobs_orphans_idx ON blobs (touched_at) WHERE refcount = 0;
+
+-- History versions recorded before blobs existed keep their per-domain
+-- objects; adopt them as blobs so the new foreign key holds.
+INSERT INTO blobs (hash, storage_key, storage_url, content_type, size, refcount)
+SELECT DISTINCT ON (content_hash) content_hash, storage_key, storage_url, content_type, 0, 0
+FROM icon_versions
+ORDER BY content_hash, id
+ON CONFLICT (hash) DO NOTHING;
+
+ALTER TABLE icons ADD COLUMN IF NOT EXISTS content_hash TEXT REFERENCES blobs(hash);
+ALTER TABLE icon_versions
+  ADD CONSTRAINT icon_versions_content_hash_fkey FOREIGN KEY (content_hash) REFERENCES blobs(hash);
+CREATE INDEX IF NOT EXISTS icons_content_hash_idx ON icons (content_hash);
+CREATE INDEX IF NOT EXISTS icon_versions_content_hash_idx ON icon_versions (content_hash);
+
+CREATE OR REPLACE FUNCTION favget_blob_refcount() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.content_hash IS NOT NULL THEN
+    UPDATE blobs SET refcount = refcount - 1 WHERE hash = OLD.content_hash;
+  END IF;
+  IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.content_hash IS NOT NULL THEN
+    UPDATE blobs SET refcount = refcount + 1, touched_at = NOW() WHERE hash = NEW.content_hash;
+  END IF;
+  RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER icons_blob_refcount
+  AFTER INSERT OR DELETE OR UPDATE OF content_hash ON icons
+  FOR EACH ROW EXECUTE FUNCTION favget_blob_refcount();
+CREATE TRIGGER icon_versions_blob_refcount
+  AFTER INSERT OR DELETE OR UPDATE OF content_hash ON icon_versions
+  FOR EACH ROW EXECUTE FUNCTION favget_blob_refcount();
+
+UPDATE blobs b SET refcount = (SELECT COUNT(*) FROM icon_versions v WHERE v.content_hash = b.hash);
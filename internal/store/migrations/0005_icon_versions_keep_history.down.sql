@@ -0,0 +1,3 @@
+DELETE FROM icon_versions v WHERE NOT EXISTS (SELECT 1 FROM icons i WHERE i.domain = v.domain);
+ALTER TABLE icon_versions
+  ADD CONSTRAINT icon_versions_domain_fkey FOREIGN KEY (domain) REFERENCES icons(domain) ON DELETE CASCADE;
@@ -0,0 +1,3 @@
+-- History outlives the icons row: purging or re-resolving a domain must not
+-- erase its before/after record. Admin purges delete it only on request.
+ALTER TABLE icon_versions DROP CONSTRAINT IF EXISTS icon_versions_domain_fkey;
@@ -0,0 +1,5 @@
+-- Keys of the renditions derived from each blob, so the sweeper can delete
+-- them one by one instead of listing a prefix per blob. Blobs that existed
+-- before stay NULL: their renditions are unknown and are found by prefix.
+ALTER TABLE blobs ADD COLUMN IF NOT EXISTS renditions TEXT[];
+ALTER TABLE blobs ALTER COLUMN renditions SET DEFAULT '{}';
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// IconVersion is one entry in a domain's icon history.
+type IconVersion struct {
+	ID          int64
+	Domain      string
+	SourceURL   string
+	StorageURL  string
+	StorageKey  string // ObjectStore key of the bytes
+	ContentHash string // hex SHA-256 of the stored bytes; references blobs
+	ContentType *string
+	Width       *int32
+	Height      *int32
+	DetectedAt  time.Time
+}
+
+const versionColumns = `id, domain, COALESCE(source_url, ''), storage_url, storage_key, content_hash, content_type, width, height, detected_at`
+
+func scanVersion(row rowScanner) (IconVersion, error) {
+	v := IconVersion{}
+	err := row.Scan(&v.ID, &v.Domain, &v.SourceURL, &v.StorageURL, &v.StorageKey, &v.ContentHash, &v.ContentType, &v.Width, &v.Height, &v.DetectedAt)
+	return v, err
+}
+
+// AddVersion appends v to its domain's history unless the newest version
+// already has the same content hash, in which case it returns
+// pgx.ErrNoRows. History is kept independently of the icons row.
+func (d *DB) AddVersion(ctx context.Context, v IconVersion) (*IconVersion, error) {
+	row := d.Pool.QueryRow(ctx, `
+		INSERT INTO icon_versions (domain, source_url, storage_url, storage_key, content_hash, content_type, width, height)
+		SELECT $1::text, $2::text, $3::text, $4::text, $5::text, $6::varchar, $7::int, $8::int
+		WHERE $5::text IS DISTINCT FROM (
+		  SELECT content_hash FROM icon_versions WHERE domain=$1 ORDER BY id DESC LIMIT 1
+		)
+		RETURNING `+versionColumns,
+		v.Domain, v.SourceURL, v.StorageURL, v.StorageKey, v.ContentHash, v.ContentType, v.Width, v.Height)
+	out, err := scanVersion(row)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListVersions returns up to limit versions of domain, newest first.
+func (d *DB) ListVersions(ctx context.Context, domain string, limit int) ([]IconVersion, error) {
+	rows, err := d.Pool.Query(ctx, `
+		SELECT `+versionColumns+` FROM icon_versions
+		WHERE domain=$1 ORDER BY id DESC LIMIT $2`, domain, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []IconVersion
+	for rows.Next() {
+		v, err := scanVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// DeleteVersions removes the history of every domain matching pattern, as
+// in DeleteMatching, and returns the removed versions.
+func (d *DB) DeleteVersions(ctx context.Context, pattern string) ([]IconVersion, error) {
+	like := likeEscaper.Replace(pattern)
+	like = strings.ReplaceAll(like, "*", "%")
+	rows, err := d.Pool.Query(ctx, `DELETE FROM icon_versions WHERE domain LIKE $1 RETURNING `+versionColumns, like)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []IconVersion
+	for rows.Next() {
+		v, err := scanVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// FindVersion returns the version with the given id, or pgx.ErrNoRows.
+func (d *DB) FindVersion(ctx context.Context, id int64) (*IconVersion, error) {
+	row := d.Pool.QueryRow(ctx, `SELECT `+versionColumns+` FROM icon_versions WHERE id=$1`, id)
+	v, err := scanVersion(row)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
@@ -6,12 +6,14 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/kudanilll/favget/internal/cache"
 	"github.com/kudanilll/favget/internal/cloud"
 	"github.com/kudanilll/favget/internal/config"
 	httpx "github.com/kudanilll/favget/internal/http"
 	"github.com/kudanilll/favget/internal/resolver"
+	"github.com/kudanilll/favget/internal/storage"
 	"github.com/kudanilll/favget/internal/store"
 )
 
@@ -26,38 +28,127 @@ func NewHandler() (http.Handler, func(), error) {
 	if err != nil {
 		return nil, func() {}, err
 	}
+	if err := prepareSchema(ctx, db, cfg.AutoMigrate); err != nil {
+		db.Close()
+		return nil, func() {}, err
+	}
 
-	cch := cache.New(cfg.RedisURL, cfg.CacheTTLSec)
+	cch := cache.New(cache.Options{
+		RedisURL:  cfg.RedisURL,
+		TTL:       time.Duration(cfg.CacheTTLSec) * time.Second,
+		LocalSize: cfg.CacheLocalSize,
+		LocalTTL:  time.Duration(cfg.CacheLocalTTLSec) * time.Second,
+	})
 
-	cld, err := cloud.New(cfg.CloudinaryURL)
+	objects, serveObjects, err := newObjectStore(cfg)
 	if err != nil {
 		db.Close()
 		return nil, func() {}, err
 	}
 
 	res := resolver.New(cfg.AllowInsecureTLS, cfg.MaxHTMLBytes, false)
+	res.MaxIconBytes = cfg.MaxIconBytes
+	res.MaxRedirects = cfg.MaxRedirects
+	res.SchemePolicy = resolver.SchemePolicy(cfg.SchemePolicy)
+	res.RasterizeSVG = cfg.SVGMode == "rasterize"
 
 	s := &httpx.Server{
-		DB:                  db,
-		Cache:               cch,
-		CLD:                 cld,
-		Resolver:            res,
-		APIKeys:             cfg.APIKeys,
-		AllowedOrigins:      parseAllowedOrigins(cfg.AllowedOrigins),
-		NegativeCacheTTLSec: cfg.NegativeCacheTTLSec,
-		RateLimitRPS:        cfg.RateLimitRPS,
+		DB:                      db,
+		Cache:                   cch,
+		Store:                   objects,
+		ServeObjects:            serveObjects,
+		DefaultMode:             cfg.IconDeliveryMode,
+		Resolver:                res,
+		APIKeys:                 cfg.APIKeys,
+		AdminAPIKeys:            cfg.AdminAPIKeys,
+		AllowedOrigins:          parseAllowedOrigins(cfg.AllowedOrigins),
+		NegativeCacheTTLSec:     cfg.NegativeCacheTTLSec,
+		NegativeTransientTTLSec: cfg.NegativeTransientTTLSec,
+		RateLimitRPS:            cfg.RateLimitRPS,
+		BatchMaxDomains:         cfg.BatchMaxDomains,
+		BatchConcurrency:        cfg.BatchConcurrency,
+		SoftTTLSec:              cfg.IconSoftTTLSec,
+		HardTTLSec:              cfg.IconHardTTLSec,
+	}
+
+	// Background revalidation of stored icons (REFRESH_INTERVAL_SECONDS=0 disables it).
+	stopRefresh := func() {}
+	if cfg.RefreshIntervalSec > 0 {
+		refreshCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			s.RunRefresher(refreshCtx, httpx.RefreshOptions{
+				Interval: time.Duration(cfg.RefreshIntervalSec) * time.Second,
+				MaxAge:   time.Duration(cfg.RefreshMaxAgeSec) * time.Second,
+				Batch:    cfg.RefreshBatchSize,
+			})
+		}()
+		stopRefresh = func() {
+			cancel()
+			<-done
+		}
 	}
 
+	// Deletion of blobs no icon or history version references any more.
+	sweepCtx, stopSweep := context.WithCancel(ctx)
+	sweepDone := make(chan struct{})
+	go func() {
+		defer close(sweepDone)
+		s.RunBlobSweeper(sweepCtx)
+	}()
+
 	cleanup := func() {
+		stopRefresh()
+		stopSweep()
+		<-sweepDone
 		db.Close()
 		if err := cch.Close(); err != nil {
-			log.Printf("warning: Redis close: %v", err)
+			log.Printf("warning: cache close: %v", err)
 		}
 	}
 
 	return s.Routes(), cleanup, nil
 }
 
+// prepareSchema applies pending migrations, or with DB_AUTO_MIGRATE=false
+// only checks that none are pending. Either way it refuses a schema newer
+// than this binary.
+func prepareSchema(ctx context.Context, db *store.DB, auto bool) error {
+	if !auto {
+		return db.CheckSchema(ctx)
+	}
+	n, err := db.Migrate(ctx)
+	if n > 0 {
+		log.Printf("applied %d schema migration(s)", n)
+	}
+	return err
+}
+
+// newObjectStore builds the storage backend selected by STORAGE_BACKEND.
+// The boolean reports whether Favget must serve the objects itself at
+// /objects/*, which is the case for the local backend unless
+// STORAGE_PUBLIC_URL points elsewhere.
+func newObjectStore(cfg config.Config) (storage.ObjectStore, bool, error) {
+	switch cfg.StorageBackend {
+	case "local":
+		public := cfg.StoragePublicURL
+		serve := public == ""
+		if serve {
+			public = "/objects"
+		}
+		st, err := storage.NewLocal(cfg.LocalStorageDir, public)
+		return st, serve, err
+	case "s3":
+		st, err := storage.NewS3(cfg.S3Endpoint, cfg.S3Bucket, cfg.S3Region,
+			cfg.S3AccessKeyID, cfg.S3SecretAccessKey, cfg.StoragePublicURL)
+		return st, false, err
+	default:
+		st, err := cloud.New(cfg.CloudinaryURL)
+		return st, false, err
+	}
+}
+
 func parseAllowedOrigins(raw string) []string {
 	raw = strings.TrimSpace(raw)
 	if raw == "" {
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kudanilll/favget/internal/store"
+)
+
+const migrateUsage = "usage: favget migrate [up | down [N] | status]"
+
+// RunMigrate implements the `migrate` subcommand. It needs only DATABASE_URL,
+// so it can run before the rest of the configuration exists:
+//
+//	favget migrate up        apply pending migrations (the default)
+//	favget migrate down [N]  revert the last N migrations (default 1)
+//	favget migrate status    print the current and latest versions
+func RunMigrate(args []string) error {
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		return errors.New("DATABASE_URL is required")
+	}
+	cmd := "up"
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	db, err := store.New(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch cmd {
+	case "up":
+		if len(args) > 0 {
+			return errors.New(migrateUsage)
+		}
+		n, err := db.Migrate(ctx)
+		fmt.Printf("applied %d migration(s)\n", n)
+		if err != nil {
+			return err
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			return errors.New(migrateUsage)
+		}
+		if len(args) == 1 {
+			if steps, err = strconv.Atoi(args[0]); err != nil || steps < 1 {
+				return errors.New(migrateUsage)
+			}
+		}
+		n, err := db.MigrateDown(ctx, steps)
+		fmt.Printf("reverted %d migration(s)\n", n)
+		if err != nil {
+			return err
+		}
+	case "status":
+		if len(args) > 0 {
+			return errors.New(migrateUsage)
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	st, err := db.SchemaStatus(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case st.Current > st.Latest:
+		fmt.Printf("schema version %d is newer than this binary (latest %d)\n", st.Current, st.Latest)
+	case st.Pending():
+		fmt.Printf("schema version %d; %d migration(s) pending (latest %d)\n", st.Current, st.Latest-st.Current, st.Latest)
+	default:
+		fmt.Printf("schema version %d (up to date)\n", st.Current)
+	}
+	return nil
+}